@@ -0,0 +1,126 @@
+package gedcb
+
+import (
+	"time"
+)
+
+// DecayedCounts are a breaker's decayed success and failure sums normalized to Timestamp.
+// Since they no longer depend on the breaker's landmark, counts from different nodes can be decayed to a common time and added up.
+type DecayedCounts struct {
+	Timestamp time.Time
+	Successes float64
+	Failures  float64
+}
+
+// Total returns the decayed number of requests.
+func (c DecayedCounts) Total() float64 {
+	return c.Successes + c.Failures
+}
+
+// FailureRate returns the ratio of failures to requests, or zero if there were no requests.
+func (c DecayedCounts) FailureRate() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+
+	return c.Failures / c.Total()
+}
+
+// Counts returns the breaker's decayed success and failure sums normalized to the given timestamp.
+// This is the value peers expect in UpdatePeerCounts.
+func (b *Breaker) Counts(timestamp time.Time) DecayedCounts {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.counts(timestamp)
+}
+
+// counts implements Counts.
+func (b *Breaker) counts(timestamp time.Time) DecayedCounts {
+	factor := b.decay.NormalizingFactor(timestamp)
+
+	return DecayedCounts{
+		Timestamp: timestamp,
+		Successes: b.successes / factor,
+		Failures:  b.failures / factor,
+	}
+}
+
+// UpdatePeerCounts updates the decayed counts reported by a peer in the breaker.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) UpdatePeerCounts(peer string, counts DecayedCounts) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if current, found := b.peerCounts[peer]; found && current.Timestamp.After(counts.Timestamp) {
+		return
+	}
+
+	b.peerCounts[peer] = counts
+}
+
+// ClusterCounts returns the breaker's own counts plus the counts of every peer decayed to the given timestamp.
+// Peer counts older than the configured TTL are dropped.
+func (b *Breaker) ClusterCounts(timestamp time.Time) DecayedCounts {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.clusterCounts(timestamp)
+}
+
+// clusterCounts implements ClusterCounts.
+func (b *Breaker) clusterCounts(timestamp time.Time) DecayedCounts {
+	total := b.counts(timestamp)
+
+	for peer, counts := range b.peerCounts {
+		if b.config.ClusterCountsTTL > 0 && timestamp.Sub(counts.Timestamp) > b.config.ClusterCountsTTL {
+			delete(b.peerCounts, peer)
+			delete(b.peerBaselines, peer)
+			continue
+		}
+
+		counts = b.sinceBaseline(peer, counts)
+
+		// counts from a peer whose clock is ahead are treated as current.
+		weight := min(b.decay.Weight(NewBasicItem(counts.Timestamp, 1.0), timestamp), 1.0)
+		total.Successes += counts.Successes * weight
+		total.Failures += counts.Failures * weight
+	}
+
+	return total
+}
+
+// baselinePeerCounts records the peers' counts when the breaker closes, so that the failures they counted before it closed do not make it
+// suspect again right away. Only what peers count afterwards adds up in ClusterCounts.
+func (b *Breaker) baselinePeerCounts() {
+	clear(b.peerBaselines)
+	for peer, counts := range b.peerCounts {
+		b.peerBaselines[peer] = counts
+	}
+}
+
+// sinceBaseline returns what a peer counted since its baseline, if any, both decayed to the counts' timestamp.
+func (b *Breaker) sinceBaseline(peer string, counts DecayedCounts) DecayedCounts {
+	baseline, found := b.peerBaselines[peer]
+	if !found {
+		return counts
+	}
+
+	weight := min(b.decay.Weight(NewBasicItem(baseline.Timestamp, 1.0), counts.Timestamp), 1.0)
+	counts.Successes = max(counts.Successes-baseline.Successes*weight, 0)
+	counts.Failures = max(counts.Failures-baseline.Failures*weight, 0)
+
+	return counts
+}
+
+// clusterSuspect returns true if cluster aggregation is enabled and the cluster-wide failure rate exceeds the threshold.
+// Breakers in local-only mode fall back to their own failure thresholds.
+func (b *Breaker) clusterSuspect(timestamp time.Time) bool {
+	if !b.config.ClusterAggregate || b.localOnly {
+		return false
+	}
+
+	counts := b.clusterCounts(timestamp)
+
+	return counts.Total() >= float64(b.config.ClusterMinimumRequests) && counts.FailureRate() > b.config.ClusterFailureRateThreshold
+}
@@ -0,0 +1,116 @@
+package gedcb
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newAggregateBreaker(landmark time.Time) *Breaker {
+	config := BreakerConfig{
+		WindowSize:                  time.Minute,
+		SuspicionSuccessThreshold:   10,
+		SoftFailureThreshold:        5,
+		HardFailureThreshold:        50,
+		HalfOpenFailureThreshold:    2,
+		HalfOpenSuccessThreshold:    2,
+		OpenDuration:                time.Second,
+		ClusterAggregate:            true,
+		ClusterFailureRateThreshold: 0.03,
+		ClusterMinimumRequests:      200,
+		ClusterCountsTTL:            time.Minute,
+	}
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize))
+
+	return NewBreaker(config, decay)
+}
+
+func TestBreakerClusterAggregate(t *testing.T) {
+	landmark := time.Now()
+	breaker := newAggregateBreaker(landmark)
+
+	// 4% failures locally stays well below the soft failure threshold
+	for i := 0; i < 96; i++ {
+		require.NoError(t, breaker.Success(landmark))
+	}
+	for i := 0; i < 4; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Closed, breaker.State(landmark))
+	require.Equal(t, DecayedCounts{Timestamp: landmark, Successes: 96, Failures: 4}, breaker.Counts(landmark))
+
+	// every peer sees the same 4%, which the cluster as a whole treats as an outage
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark, Successes: 96, Failures: 4})
+	breaker.UpdatePeerCounts("b", DecayedCounts{Timestamp: landmark, Successes: 96, Failures: 4})
+	require.Equal(t, DecayedCounts{Timestamp: landmark, Successes: 288, Failures: 12}, breaker.ClusterCounts(landmark))
+
+	require.Equal(t, Suspicion, breaker.State(landmark))
+	require.NoError(t, breaker.Success(landmark))
+	require.Equal(t, Open, breaker.State(landmark))
+}
+
+func TestBreakerClusterAggregateDisabled(t *testing.T) {
+	landmark := time.Now()
+	breaker := newAggregateBreaker(landmark)
+	breaker.config.ClusterAggregate = false
+
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark, Successes: 0, Failures: 1000})
+	require.Equal(t, Closed, breaker.State(landmark))
+}
+
+func TestBreakerClusterAggregateLocalOnly(t *testing.T) {
+	landmark := time.Now()
+	breaker := newAggregateBreaker(landmark)
+	breaker.SetLocalOnly(true)
+
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark, Successes: 0, Failures: 1000})
+	require.Equal(t, Closed, breaker.State(landmark))
+
+	breaker.SetLocalOnly(false)
+	require.Equal(t, Suspicion, breaker.State(landmark))
+}
+
+func TestBreakerClusterCountsBaseline(t *testing.T) {
+	landmark := time.Now()
+	breaker := newAggregateBreaker(landmark)
+
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark, Failures: 1000})
+	require.Equal(t, Suspicion, breaker.State(landmark))
+	require.Equal(t, Open, breaker.State(landmark))
+
+	halfOpen := landmark.Add(2 * time.Second)
+	require.Equal(t, HalfOpen, breaker.State(halfOpen))
+	for breaker.State(halfOpen) == HalfOpen {
+		require.NoError(t, breaker.Success(halfOpen))
+	}
+	require.Equal(t, Closed, breaker.State(halfOpen))
+
+	// the failures the peer counted before the breaker closed do not make it suspect again
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark.Add(3 * time.Second), Failures: 800})
+	require.Equal(t, Closed, breaker.State(landmark.Add(3*time.Second)))
+	require.Equal(t, 0.0, breaker.ClusterCounts(landmark.Add(3*time.Second)).Failures)
+
+	// but new ones do
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark.Add(4 * time.Second), Failures: 1300})
+	require.Equal(t, Suspicion, breaker.State(landmark.Add(4*time.Second)))
+}
+
+func TestBreakerClusterCountsDecay(t *testing.T) {
+	landmark := time.Now()
+	breaker := newAggregateBreaker(landmark)
+
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark, Successes: 10, Failures: 100})
+	// older counts from the same peer are ignored
+	breaker.UpdatePeerCounts("a", DecayedCounts{Timestamp: landmark.Add(-time.Second), Failures: 1})
+
+	counts := breaker.ClusterCounts(landmark.Add(30 * time.Second))
+	require.InDelta(t, 10*0.316, counts.Successes, 0.01)
+	require.InDelta(t, 100*0.316, counts.Failures, 0.1)
+
+	// stale contributions from departed nodes age out
+	require.Equal(t, 0.0, breaker.ClusterCounts(landmark.Add(2*time.Minute)).Total())
+
+	breaker.UpdatePeerCounts("b", DecayedCounts{Timestamp: landmark, Failures: 100})
+	breaker.DeletePeer("b")
+	require.Equal(t, 0.0, breaker.ClusterCounts(landmark).Total())
+}
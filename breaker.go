@@ -2,7 +2,9 @@ package gedcb
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"strings"
 	"sync"
 	"time"
 )
@@ -15,9 +17,45 @@ type BreakerConfig struct {
 	HalfOpenFailureThreshold  int
 	HalfOpenSuccessThreshold  int
 	OpenDuration              time.Duration
-	OnStateChange             func(State, State)
+	// OnStateChange is called with the breaker locked, so it must not call back into the breaker.
+	OnStateChange func(State, State)
+	// OnTransition is called after OnStateChange with the reason for the change. It is also called with the breaker locked.
+	OnTransition func(StateChange)
+	// VotingPolicy decides whether the peers' votes amount to a majority suspecting a failure. Defaults to SimpleMajority.
+	VotingPolicy VotingPolicy
+	// ActivityWindow is how long after its last success or failure the breaker is considered active. Idle peers do not vote.
+	// Zero considers the breaker always active.
+	ActivityWindow time.Duration
+	// MaxPeerHealthScore suppresses the votes of peers whose health score, see UpdatePeerHealth, is at least this high.
+	// Zero counts every peer, down-weighted by its score.
+	MaxPeerHealthScore int
+	// OpenQuorum is the fraction of the peers' votes, by weight, that must be Open for the breaker to open right away, even from Closed,
+	// instead of waiting to suspect a failure itself. Zero disables it.
+	OpenQuorum float64
+	// RemoteOpenDuration, if set, moves breakers opened by the OpenQuorum to RemoteOpen for this duration instead of Open for the OpenDuration.
+	// RemoteOpen peers do not count towards the OpenQuorum, so fast opens do not echo around the cluster once the failing peers recover.
+	RemoteOpenDuration time.Duration
+	// ProbeTimeout enables coordinated probing: while in HalfOpen, a breaker that is not its cluster's prober, see SetProber, rejects calls
+	// and waits for the prober's result, see ProbeResult. It probes on its own once the timeout elapses without a result, such as when
+	// the prober died. Zero lets every breaker probe on its own.
+	ProbeTimeout time.Duration
+	// DeferWhenUnhealthy keeps the breaker from opening on its own hard failure threshold while SetLocalHealth reports it unhealthy,
+	// so that it only opens when its peers agree. A breaker without voting peers still opens on its own.
+	DeferWhenUnhealthy bool
+	// FailureKeys is the number of heavy-hitter keys to track for failures. Zero disables tracking.
+	FailureKeys int
+	// ClusterAggregate opts into evaluating the failure rate of the breaker's counts summed with those reported by peers via UpdatePeerCounts.
+	ClusterAggregate bool
+	// ClusterFailureRateThreshold is the cluster-wide failure rate, between 0 and 1, above which the breaker suspects and then opens.
+	ClusterFailureRateThreshold float64
+	// ClusterMinimumRequests is the cluster-wide decayed number of requests below which the failure rate is not evaluated.
+	ClusterMinimumRequests int
+	// ClusterCountsTTL is how long after their timestamp peer counts and failure keys are ignored. Zero relies on the decay alone.
+	ClusterCountsTTL time.Duration
 }
 
+// Breaker is a circuit breaker that also opens when the majority of its peers suspect a failure.
+// It is safe for concurrent use.
 type Breaker struct {
 	config          BreakerConfig
 	decay           ForwardDecay
@@ -25,8 +63,19 @@ type Breaker struct {
 	successes       float64
 	failures        float64
 	deadline        time.Time
-	peers           map[string]State
+	peers           map[string]Vote
 	majoritySuspect bool
+	openQuorum      bool
+	lastChange      StateChange
+	lastActivity    time.Time
+	localHealth     int
+	localOnly       bool
+	notProber       bool
+	probeDeadline   time.Time
+	peerCounts      map[string]DecayedCounts
+	peerBaselines   map[string]DecayedCounts
+	failureKeys     *HeavyHitters
+	peerFailures    map[string]DecayedFailures
 	mutex           sync.Mutex
 }
 
@@ -37,109 +86,403 @@ const (
 	Suspicion
 	Open
 	HalfOpen
+	// RemoteOpen rejects calls like Open, but only because a quorum of the breaker's peers are open. See BreakerConfig.RemoteOpenDuration.
+	RemoteOpen
 )
 
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "Closed"
+	case Suspicion:
+		return "Suspicion"
+	case Open:
+		return "Open"
+	case HalfOpen:
+		return "HalfOpen"
+	case RemoteOpen:
+		return "RemoteOpen"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Rejects returns true if the breaker rejects calls in the state.
+func (s State) Rejects() bool {
+	return s == Open || s == RemoteOpen
+}
+
+// StateChange describes a transition of a breaker and the reason for it.
+type StateChange struct {
+	From      State
+	To        State
+	Reason    string
+	Timestamp time.Time
+}
+
+func (s StateChange) String() string {
+	return fmt.Sprintf("%v -> %v: %s", s.From, s.To, s.Reason)
+}
+
 // OpenBreakerErr is returned when the breaker is open.
 var OpenBreakerErr = errors.New("open breaker")
 
 // NewBreaker creates a new breaker with the given configuration, decay function, and landmark.
 func NewBreaker(config BreakerConfig, decay ForwardDecay) *Breaker {
+	if config.VotingPolicy == nil {
+		config.VotingPolicy = SimpleMajority{}
+	}
+
 	return &Breaker{
-		config:   config,
-		decay:    decay,
-		state:    Closed,
-		deadline: decay.Landmark(),
-		peers:    make(map[string]State),
+		config:        config,
+		decay:         decay,
+		state:         Closed,
+		deadline:      decay.Landmark(),
+		peers:         make(map[string]Vote),
+		peerCounts:    make(map[string]DecayedCounts),
+		peerBaselines: make(map[string]DecayedCounts),
+		failureKeys:   NewHeavyHitters(config.FailureKeys, decay),
+		peerFailures:  make(map[string]DecayedFailures),
 	}
 }
 
-// Acquire returns an error if the breaker is open. Otherwise, it returns nil.
+// Config returns the breaker's configuration.
+func (b *Breaker) Config() BreakerConfig {
+	return b.config
+}
+
+// Acquire returns an error if the breaker is open, or waiting for its prober's result. Otherwise, it returns nil.
 func (b *Breaker) Acquire(timestamp time.Time) error {
-	if b.State(timestamp) == Open {
+	if b.State(timestamp).Rejects() {
+		return OpenBreakerErr
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.waitingForProbe(timestamp) {
 		return OpenBreakerErr
 	}
 
 	return nil
 }
 
+// rejects returns true if the breaker rejects calls, because it is open or waiting for its prober's result.
+func (b *Breaker) rejects(timestamp time.Time) bool {
+	return b.state.Rejects() || b.waitingForProbe(timestamp)
+}
+
+// waitingForProbe returns true if the breaker is in HalfOpen and leaves probing to its cluster's prober until the ProbeTimeout elapses.
+func (b *Breaker) waitingForProbe(timestamp time.Time) bool {
+	return b.state == HalfOpen && b.config.ProbeTimeout > 0 && b.notProber && timestamp.Before(b.probeDeadline)
+}
+
 // Success records a success in the breaker. It returns an error if the breaker is open.
 func (b *Breaker) Success(timestamp time.Time) error {
-	if b.state == Open {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.rejects(timestamp) {
 		return OpenBreakerErr
 	}
 
-	item := NewBasicItem(time.Now(), 1.0)
+	item := NewBasicItem(timestamp, 1.0)
 	b.successes += b.decay.StaticWeight(item)
-	b.Transition(timestamp)
+	b.recordActivity(timestamp)
+	b.transition(timestamp)
 
 	return nil
 }
 
 // Failure records a failure in the breaker. It returns an error if the breaker is open.
-func (b *Breaker) Failure(timestamp time.Time) error {
-	if b.state == Open {
+// The optional keys (e.g. endpoint, tenant or error code) are tracked as the breaker's top failure keys.
+func (b *Breaker) Failure(timestamp time.Time, keys ...string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.rejects(timestamp) {
 		return OpenBreakerErr
 	}
 
 	item := NewBasicItem(timestamp, 1.0)
 	b.failures += b.decay.StaticWeight(item)
-	b.Transition(timestamp)
+	b.recordActivity(timestamp)
+
+	for _, key := range keys {
+		b.failureKeys.Add(key, item)
+	}
+
+	b.transition(timestamp)
 
 	return nil
 }
 
+// recordActivity remembers the time of the latest success or failure.
+func (b *Breaker) recordActivity(timestamp time.Time) {
+	if timestamp.After(b.lastActivity) {
+		b.lastActivity = timestamp
+	}
+}
+
+// Active returns true if the breaker recorded a success or failure within the ActivityWindow, or if the window is zero.
+func (b *Breaker) Active(timestamp time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.config.ActivityWindow == 0 || (!b.lastActivity.IsZero() && timestamp.Sub(b.lastActivity) <= b.config.ActivityWindow)
+}
+
 // Transition computes the new state of the breaker based on the current state and the number of successes and failures.
 func (b *Breaker) Transition(timestamp time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.transition(timestamp)
+}
+
+// transition implements Transition. OnStateChange is called with the breaker locked, so it must not call back into the breaker.
+func (b *Breaker) transition(timestamp time.Time) {
 	initialState := b.state
+	var reason string
 
 	switch initialState {
 	case Closed:
-		if b.Failures(timestamp) > b.config.SoftFailureThreshold {
+		if b.failureCount(timestamp) > b.config.SoftFailureThreshold {
 			b.state = Suspicion
+			reason = "soft failure threshold exceeded"
+		} else if b.clusterSuspect(timestamp) {
+			b.state = Suspicion
+			reason = "cluster failure rate threshold exceeded"
+		} else if b.fastOpen() {
+			reason = b.openRemotely(timestamp)
 		}
 	case Suspicion:
-		if b.Successes(timestamp) > b.config.SuspicionSuccessThreshold {
+		// local successes must not close the breaker while the cluster as a whole sees an elevated failure rate.
+		if b.clusterSuspect(timestamp) {
+			b.state = Open
+			reason = "cluster failure rate threshold exceeded"
+			b.clearWindow()
+			b.startTimer(timestamp)
+		} else if b.successCount(timestamp) > b.config.SuspicionSuccessThreshold {
 			b.state = Closed
+			reason = "suspicion success threshold exceeded"
 			b.clearWindow()
-		} else if b.Failures(timestamp) > b.config.HardFailureThreshold {
+		} else if b.failureCount(timestamp) > b.config.HardFailureThreshold && !b.deferring() {
 			b.state = Open
+			reason = "hard failure threshold exceeded"
 			b.clearWindow()
 			b.startTimer(timestamp)
-		} else if b.majoritySuspect {
+		} else if b.majoritySuspect && !b.localOnly {
 			b.state = Open
+			reason = b.majorityReason()
 			b.clearWindow()
 			b.startTimer(timestamp)
+		} else if b.fastOpen() {
+			reason = b.openRemotely(timestamp)
 		}
-	case Open:
+	case Open, RemoteOpen:
 		if timestamp.After(b.deadline) {
 			b.state = HalfOpen
+			reason = "open duration elapsed"
+			b.probeDeadline = timestamp.Add(b.config.ProbeTimeout)
 		}
 	case HalfOpen:
-		if b.Failures(timestamp) > b.config.HalfOpenFailureThreshold {
+		if b.failureCount(timestamp) > b.config.HalfOpenFailureThreshold {
 			b.state = Open
+			reason = "half-open failure threshold exceeded"
 			b.clearWindow()
 			b.startTimer(timestamp)
-		} else if b.Successes(timestamp) > b.config.HalfOpenSuccessThreshold {
+		} else if b.successCount(timestamp) > b.config.HalfOpenSuccessThreshold {
 			b.state = Closed
+			reason = "half-open success threshold exceeded"
 			b.clearWindow()
 		}
 	}
 
-	if b.state != initialState && b.config.OnStateChange != nil {
+	b.changed(initialState, reason, timestamp)
+}
+
+// changed records the breaker's transition from the initial state, if any, and calls OnStateChange and OnTransition.
+func (b *Breaker) changed(initialState State, reason string, timestamp time.Time) {
+	if b.state == initialState {
+		return
+	}
+
+	if b.state == Closed {
+		b.baselinePeerCounts()
+	}
+
+	b.lastChange = StateChange{From: initialState, To: b.state, Reason: reason, Timestamp: timestamp}
+
+	if b.config.OnStateChange != nil {
 		b.config.OnStateChange(initialState, b.state)
 	}
+
+	if b.config.OnTransition != nil {
+		b.config.OnTransition(b.lastChange)
+	}
+}
+
+// deferring returns true if the breaker leaves opening to its peers because the local node is unhealthy.
+func (b *Breaker) deferring() bool {
+	return b.config.DeferWhenUnhealthy && b.localHealth > 0 && !b.localOnly && len(b.activeVotes()) > 0
+}
+
+// fastOpen returns true if a quorum of the peers are open and the breaker does not ignore them.
+func (b *Breaker) fastOpen() bool {
+	return b.openQuorum && !b.localOnly
+}
+
+// openRemotely opens the breaker because a quorum of its peers are open, in RemoteOpen if it has a RemoteOpenDuration.
+// It returns the reason for the transition.
+func (b *Breaker) openRemotely(timestamp time.Time) string {
+	b.state = Open
+	if b.config.RemoteOpenDuration > 0 {
+		b.state = RemoteOpen
+	}
+
+	b.clearWindow()
+	b.startTimer(timestamp)
+
+	votes := b.activeVotes()
+	open := 0
+	for _, vote := range votes {
+		if vote.State == Open {
+			open++
+		}
+	}
+
+	return fmt.Sprintf("%d of %d peers are open (quorum of %v)", open, len(votes), b.config.OpenQuorum)
+}
+
+// majorityReason describes the peers' votes that opened the breaker and the policy that counted them.
+func (b *Breaker) majorityReason() string {
+	votes := b.activeVotes()
+
+	suspects := 0
+	for _, vote := range votes {
+		if vote.Suspects() {
+			suspects++
+		}
+	}
+
+	reason := fmt.Sprintf("%d of %d peers suspect a failure (%s)", suspects, len(votes), b.config.VotingPolicy)
+	if zones := suspectZones(votes); len(zones) > 1 || (len(zones) == 1 && zones[0] != unzoned) {
+		reason += fmt.Sprintf(" in zones %s", strings.Join(zones, ", "))
+	}
+
+	idle, unhealthy, degraded := 0, 0, 0
+	for peer, vote := range b.peers {
+		if _, voted := votes[peer]; voted {
+			if vote.Health > 0 {
+				degraded++
+			}
+		} else if vote.Idle {
+			idle++
+		} else {
+			unhealthy++
+		}
+	}
+
+	if idle > 0 {
+		reason += fmt.Sprintf(", ignoring %d idle peers", idle)
+	}
+
+	if unhealthy > 0 {
+		reason += fmt.Sprintf(", ignoring %d unhealthy peers", unhealthy)
+	}
+
+	if degraded > 0 {
+		reason += fmt.Sprintf(", down-weighting %d unhealthy peers", degraded)
+	}
+
+	return reason
+}
+
+// LastStateChange returns the breaker's most recent transition, or the zero StateChange if it never changed state.
+func (b *Breaker) LastStateChange() StateChange {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.lastChange
 }
 
 // Successes returns the number of successes in the breaker's current window.
 func (b *Breaker) Successes(timestamp time.Time) int {
-	return int(math.Ceil(b.successes / b.decay.NormalizingFactor(timestamp)))
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.successCount(timestamp)
 }
 
 // Failures returns the number of failures in the breaker's current window.
 func (b *Breaker) Failures(timestamp time.Time) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.failureCount(timestamp)
+}
+
+// successCount implements Successes.
+func (b *Breaker) successCount(timestamp time.Time) int {
+	return int(math.Ceil(b.successes / b.decay.NormalizingFactor(timestamp)))
+}
+
+// failureCount implements Failures.
+func (b *Breaker) failureCount(timestamp time.Time) int {
 	return int(math.Ceil(b.failures / b.decay.NormalizingFactor(timestamp)))
 }
 
+// TopFailures returns the keys responsible for the most failures, sorted by decreasing decayed count.
+func (b *Breaker) TopFailures(timestamp time.Time) []HeavyHitter {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.failureKeys.Top(timestamp)
+}
+
+// UpdatePeerFailures replaces the top failure keys reported by a peer in the breaker. Each peer's keys are kept apart from the breaker's own,
+// so a peer reporting the same failures again does not count them twice.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) UpdatePeerFailures(peer string, failures DecayedFailures) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if current, found := b.peerFailures[peer]; found && current.Timestamp.After(failures.Timestamp) {
+		return
+	}
+
+	b.peerFailures[peer] = failures
+}
+
+// ClusterTopFailures returns the breaker's top failure keys merged with those of every peer decayed to the given timestamp.
+// Peer keys older than the configured ClusterCountsTTL are dropped.
+func (b *Breaker) ClusterTopFailures(timestamp time.Time) []HeavyHitter {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	merged := NewHeavyHitters(b.failureKeys.Capacity(), b.decay)
+	merged.Merge(timestamp, b.failureKeys.Top(timestamp))
+
+	for peer, failures := range b.peerFailures {
+		if b.config.ClusterCountsTTL > 0 && timestamp.Sub(failures.Timestamp) > b.config.ClusterCountsTTL {
+			delete(b.peerFailures, peer)
+			continue
+		}
+
+		// keys from a peer whose clock is ahead are treated as current.
+		weight := min(b.decay.Weight(NewBasicItem(failures.Timestamp, 1.0), timestamp), 1.0)
+		keys := make([]HeavyHitter, 0, len(failures.Keys))
+		for _, key := range failures.Keys {
+			keys = append(keys, HeavyHitter{Key: key.Key, Count: key.Count * weight, Error: key.Error * weight})
+		}
+
+		merged.Merge(timestamp, keys)
+	}
+
+	return merged.Top(timestamp)
+}
+
 // clearWindow resets the number of successes and failures in the breaker's current window.
 // It also resets the window's deadline, used as the timer for transitioning from Open to HalfOpen.
 func (b *Breaker) clearWindow() {
@@ -148,24 +491,36 @@ func (b *Breaker) clearWindow() {
 	b.deadline = b.decay.Landmark()
 }
 
-// startTimer sets the deadline for the breaker to transition from Open to HalfOpen.
+// startTimer sets the deadline for the breaker to transition from Open, or RemoteOpen, to HalfOpen.
 func (b *Breaker) startTimer(timestamp time.Time) {
-	b.deadline = timestamp.Add(b.config.OpenDuration)
+	if b.state == RemoteOpen {
+		b.deadline = timestamp.Add(b.config.RemoteOpenDuration)
+	} else {
+		b.deadline = timestamp.Add(b.config.OpenDuration)
+	}
 }
 
 // Deadline returns the deadline for the breaker to transition from Open to HalfOpen.
 func (b *Breaker) Deadline() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
 	return b.deadline
 }
 
 // State returns the current state of the breaker. It also updates the state based on the current time.
 func (b *Breaker) State(timestamp time.Time) State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
 	age := b.decay.SetLandmark(timestamp)
 	factor := b.decay.G(age)
 
 	b.successes /= factor
 	b.failures /= factor
-	b.Transition(timestamp)
+	// the failure keys keep their own landmark, which must move along or their static weights overflow.
+	b.failureKeys.rescale(timestamp)
+	b.transition(timestamp)
 
 	return b.state
 }
@@ -176,30 +531,175 @@ func (b *Breaker) UpdatePeer(peer string, state State) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	b.peers[peer] = state
-	b.majoritySuspect = b.computeMajoritySuspect()
+	vote := b.peers[peer]
+	vote.State = state
+	b.peers[peer] = vote
+	b.countVotes()
+}
+
+// UpdatePeerActivity records whether a peer recently called the breaker's downstream. Idle peers do not vote.
+// Peers are active until told otherwise.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) UpdatePeerActivity(peer string, active bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	vote := b.peers[peer]
+	vote.Idle = !active
+	b.peers[peer] = vote
+	b.countVotes()
+}
+
+// UpdatePeerZone tags a peer with its availability zone, used by zone-aware voting policies.
+// A peer without a state counts as Closed until UpdatePeer is called.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) UpdatePeerZone(peer string, zone string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	vote := b.peers[peer]
+	vote.Zone = zone
+	b.peers[peer] = vote
+	b.countVotes()
+}
+
+// UpdatePeerHealth records a peer's Lifeguard health score, zero when healthy. Unhealthy peers' votes weigh less,
+// and do not count at all from MaxPeerHealthScore.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) UpdatePeerHealth(peer string, score int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	vote := b.peers[peer]
+	vote.Health = score
+	b.peers[peer] = vote
+	b.countVotes()
+}
+
+// SetLocalHealth records the local node's Lifeguard health score, zero when healthy. See DeferWhenUnhealthy.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) SetLocalHealth(score int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.localHealth = score
 }
 
-// DeletePeer removes the state of a peer in the breaker. Then, recomputes whether the majority of peers suspect a failure.
+// SetProber tells the breaker whether it probes the downstream for its cluster while in HalfOpen. Breakers are probers until told otherwise.
+// See ProbeTimeout. This can be called concurrently from any go-routine.
+func (b *Breaker) SetProber(prober bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.notProber = !prober
+}
+
+// ProbeResult applies the outcome of a peer's probe to a breaker in HalfOpen: Closed closes it, and Open opens it again for the OpenDuration.
+// Breakers in any other state, or outcomes in any other state, are left alone.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) ProbeResult(state State, timestamp time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.transition(timestamp)
+	if b.state != HalfOpen {
+		return
+	}
+
+	var reason string
+	switch state {
+	case Closed:
+		b.state = Closed
+		reason = "peer's probe succeeded"
+		b.clearWindow()
+	case Open:
+		b.state = Open
+		reason = "peer's probe failed"
+		b.clearWindow()
+		b.startTimer(timestamp)
+	default:
+		return
+	}
+
+	b.changed(HalfOpen, reason, timestamp)
+}
+
+// SetLocalOnly switches the breaker into a mode that ignores its peers, such as while the local node is partitioned from most of them.
+// Peers' votes and counts are still recorded, so they count again as soon as the mode is switched off.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) SetLocalOnly(localOnly bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.localOnly = localOnly
+}
+
+// LocalOnly returns true if the breaker ignores its peers. See SetLocalOnly.
+func (b *Breaker) LocalOnly() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.localOnly
+}
+
+// DeletePeer removes the state, counts and failure keys of a peer in the breaker. Then, recomputes whether the majority of peers suspect a failure.
 // This can be called concurrently from any go-routine.
 func (b *Breaker) DeletePeer(peer string) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
 	delete(b.peers, peer)
-	b.majoritySuspect = b.computeMajoritySuspect()
+	delete(b.peerCounts, peer)
+	delete(b.peerBaselines, peer)
+	delete(b.peerFailures, peer)
+	b.countVotes()
 }
 
-// computeMajoritySuspect returns true if the majority of peers suspect a failure.
-func (b *Breaker) computeMajoritySuspect() bool {
-	total := 0
-	majority := len(b.peers)/2 + 1
+// countVotes recomputes whether the voting policy finds that the majority of peers suspect a failure, and whether a quorum of them are open.
+func (b *Breaker) countVotes() {
+	votes := b.activeVotes()
+	b.majoritySuspect = b.config.VotingPolicy.MajoritySuspect(votes)
+	b.openQuorum = b.config.OpenQuorum > 0 && openQuorum(votes, b.config.OpenQuorum)
+}
 
-	for _, peer := range b.peers {
-		if peer != Closed {
-			total++
+// activeVotes returns the votes of the peers that recently called the breaker's downstream and are healthy enough to vote.
+func (b *Breaker) activeVotes() map[string]Vote {
+	votes := make(map[string]Vote, len(b.peers))
+	for peer, vote := range b.peers {
+		if !b.Counted(vote) {
+			continue
 		}
+
+		votes[peer] = vote
+	}
+
+	return votes
+}
+
+// Counted returns true if a peer's vote counts towards the majority: the peer is active and healthy enough to vote.
+func (b *Breaker) Counted(vote Vote) bool {
+	return !vote.Idle && (b.config.MaxPeerHealthScore <= 0 || vote.Health < b.config.MaxPeerHealthScore)
+}
+
+// Peers returns a copy of the peers' votes, including the ones that do not count. See Counted.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) Peers() map[string]Vote {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	peers := make(map[string]Vote, len(b.peers))
+	for peer, vote := range b.peers {
+		peers[peer] = vote
 	}
 
-	return total >= majority
+	return peers
+}
+
+// MajoritySuspect returns true if the voting policy finds that the majority of peers suspect a failure.
+// This can be called concurrently from any go-routine.
+func (b *Breaker) MajoritySuspect() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.majoritySuspect
 }
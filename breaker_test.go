@@ -1,6 +1,7 @@
 package gedcb
 
 import (
+	"errors"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
@@ -65,3 +66,222 @@ func TestBreaker(t *testing.T) {
 	}
 	require.Equal(t, Closed, breaker.State(now))
 }
+
+func TestBreakerSuccessTimestamp(t *testing.T) {
+	landmark := time.Now().Add(-time.Hour)
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, OpenDuration: time.Second}
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+
+	// a success reported at the landmark weighs the same as a failure at the landmark, regardless of the wall clock
+	require.NoError(t, breaker.Success(landmark))
+	require.NoError(t, breaker.Failure(landmark))
+	require.Equal(t, breaker.failures, breaker.successes)
+}
+
+func TestBreakerActive(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, ActivityWindow: time.Minute}
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+
+	require.False(t, breaker.Active(landmark))
+	require.NoError(t, breaker.Success(landmark))
+	require.True(t, breaker.Active(landmark.Add(time.Minute)))
+	require.False(t, breaker.Active(landmark.Add(time.Minute+time.Millisecond)))
+
+	// idle peers do not count towards the majority
+	breaker.UpdatePeer("a", Suspicion)
+	breaker.UpdatePeer("b", Closed)
+	breaker.UpdatePeer("c", Closed)
+	breaker.UpdatePeerActivity("b", false)
+	breaker.UpdatePeerActivity("c", false)
+
+	for i := 0; i <= config.SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Open, breaker.State(landmark))
+
+	config.ActivityWindow = 0
+	require.True(t, NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize))).Active(landmark))
+}
+
+func TestBreakerPeerHealth(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, MaxPeerHealthScore: 4}
+
+	suspect := func(breaker *Breaker) {
+		for i := 0; i <= config.SoftFailureThreshold; i++ {
+			require.NoError(t, breaker.Failure(landmark))
+		}
+	}
+
+	// two unhealthy suspects weigh less than one healthy peer
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Suspicion)
+	breaker.UpdatePeer("b", Suspicion)
+	breaker.UpdatePeer("c", Closed)
+	breaker.UpdatePeerHealth("a", 3)
+	breaker.UpdatePeerHealth("b", 3)
+	suspect(breaker)
+	require.Equal(t, Suspicion, breaker.State(landmark))
+	require.False(t, breaker.MajoritySuspect())
+	require.Equal(t, Vote{State: Suspicion, Health: 3}, breaker.Peers()["a"])
+	require.Len(t, breaker.Peers(), 3)
+
+	breaker.UpdatePeerHealth("b", 0)
+	require.True(t, breaker.MajoritySuspect())
+	require.Equal(t, Open, breaker.State(landmark))
+	require.Equal(t, "2 of 3 peers suspect a failure (simple majority), down-weighting 1 unhealthy peers", breaker.LastStateChange().Reason)
+
+	// peers at the maximum health score do not vote at all
+	breaker = NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Closed)
+	breaker.UpdatePeer("b", Suspicion)
+	breaker.UpdatePeerHealth("a", config.MaxPeerHealthScore)
+	require.False(t, breaker.Counted(breaker.Peers()["a"]))
+	require.True(t, breaker.Counted(breaker.Peers()["b"]))
+	suspect(breaker)
+	require.Equal(t, Open, breaker.State(landmark))
+	require.Equal(t, "1 of 1 peers suspect a failure (simple majority), ignoring 1 unhealthy peers", breaker.LastStateChange().Reason)
+}
+
+func TestBreakerDeferWhenUnhealthy(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 10, DeferWhenUnhealthy: true}
+
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Closed)
+	breaker.SetLocalHealth(2)
+
+	// while unhealthy, the breaker's own failures only get it to Suspicion
+	for i := 0; i <= config.HardFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Suspicion, breaker.State(landmark))
+
+	breaker.UpdatePeer("a", Suspicion)
+	require.Equal(t, Open, breaker.State(landmark))
+
+	// without peers to defer to, or once healthy again, it opens on its own
+	for _, setup := range []func(*Breaker){
+		func(b *Breaker) { b.SetLocalHealth(2) },
+		func(b *Breaker) { b.UpdatePeer("a", Closed) },
+	} {
+		breaker = NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+		setup(breaker)
+
+		for i := 0; i <= config.HardFailureThreshold; i++ {
+			require.NoError(t, breaker.Failure(landmark))
+		}
+		require.Equal(t, Open, breaker.State(landmark))
+	}
+}
+
+func TestBreakerLocalOnly(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 10}
+
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Suspicion)
+	breaker.SetLocalOnly(true)
+	require.True(t, breaker.LocalOnly())
+
+	// the peers' majority is ignored, but the breaker still opens on its own failures
+	for i := 0; i <= config.SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Suspicion, breaker.State(landmark))
+
+	breaker.SetLocalOnly(false)
+	require.Equal(t, Open, breaker.State(landmark))
+
+	breaker = NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Suspicion)
+	breaker.SetLocalOnly(true)
+	for i := 0; i <= config.HardFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Open, breaker.State(landmark))
+}
+
+func TestBreakerOpenQuorum(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, OpenDuration: time.Minute, OpenQuorum: 0.5}
+
+	// peers that suspect a failure do not open a closed breaker, but open ones do
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", Suspicion)
+	breaker.UpdatePeer("b", Suspicion)
+	breaker.UpdatePeer("c", Open)
+	require.Equal(t, Closed, breaker.State(landmark))
+
+	breaker.UpdatePeer("b", Open)
+	require.Equal(t, Open, breaker.State(landmark))
+	require.Equal(t, "2 of 3 peers are open (quorum of 0.5)", breaker.LastStateChange().Reason)
+	require.Equal(t, landmark.Add(config.OpenDuration), breaker.Deadline())
+
+	// with a RemoteOpenDuration, it only stays open for a shorter time, and peers in RemoteOpen do not count towards the quorum
+	config.RemoteOpenDuration = time.Second
+	breaker = NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.UpdatePeer("a", RemoteOpen)
+	breaker.UpdatePeer("b", RemoteOpen)
+	breaker.UpdatePeer("c", Open)
+	require.Equal(t, Closed, breaker.State(landmark))
+
+	breaker.UpdatePeer("a", Open)
+	require.Equal(t, RemoteOpen, breaker.State(landmark))
+	require.True(t, errors.Is(breaker.Acquire(landmark), OpenBreakerErr))
+	require.True(t, errors.Is(breaker.Success(landmark), OpenBreakerErr))
+	require.Equal(t, HalfOpen, breaker.State(landmark.Add(2*time.Second)))
+
+	// nor does a quorum open a breaker that ignores its peers
+	breaker = NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.SetLocalOnly(true)
+	breaker.UpdatePeer("a", Open)
+	require.Equal(t, Closed, breaker.State(landmark))
+}
+
+func TestBreakerProbeResult(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, HalfOpenFailureThreshold: 1, HalfOpenSuccessThreshold: 1, OpenDuration: time.Second, OpenQuorum: 0.5, ProbeTimeout: 10 * time.Second}
+	halfOpen := landmark.Add(2 * time.Second)
+
+	// a breaker that is not the prober rejects calls in HalfOpen and follows the prober's result
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+	breaker.SetProber(false)
+	breaker.UpdatePeer("a", Open)
+	require.Equal(t, Open, breaker.State(landmark))
+	require.Equal(t, HalfOpen, breaker.State(halfOpen))
+	require.True(t, errors.Is(breaker.Acquire(halfOpen), OpenBreakerErr))
+	require.True(t, errors.Is(breaker.Success(halfOpen), OpenBreakerErr))
+
+	breaker.UpdatePeer("a", Closed)
+	breaker.ProbeResult(Closed, halfOpen)
+	require.Equal(t, Closed, breaker.State(halfOpen))
+	require.Equal(t, StateChange{From: HalfOpen, To: Closed, Reason: "peer's probe succeeded", Timestamp: halfOpen}, breaker.LastStateChange())
+
+	// results do not affect breakers in other states
+	breaker.ProbeResult(Open, halfOpen)
+	require.Equal(t, Closed, breaker.State(halfOpen))
+
+	// a failed probe opens the breaker again
+	breaker.UpdatePeer("a", Open)
+	require.Equal(t, Open, breaker.State(halfOpen))
+	reopened := halfOpen.Add(2 * time.Second)
+	require.Equal(t, HalfOpen, breaker.State(reopened))
+	breaker.ProbeResult(Open, reopened)
+	require.Equal(t, Open, breaker.State(reopened))
+	require.Equal(t, "peer's probe failed", breaker.LastStateChange().Reason)
+	require.Equal(t, reopened.Add(config.OpenDuration), breaker.Deadline())
+
+	// without a result within the ProbeTimeout, the breaker probes on its own
+	halfOpen = reopened.Add(2 * time.Second)
+	require.Equal(t, HalfOpen, breaker.State(halfOpen))
+	require.True(t, errors.Is(breaker.Acquire(halfOpen.Add(config.ProbeTimeout-time.Second)), OpenBreakerErr))
+	require.NoError(t, breaker.Acquire(halfOpen.Add(config.ProbeTimeout)))
+
+	// as does the prober
+	breaker.SetProber(true)
+	breaker.ProbeResult(Open, halfOpen)
+	require.Equal(t, Open, breaker.State(halfOpen))
+	require.NoError(t, breaker.Acquire(halfOpen.Add(2*time.Second)))
+}
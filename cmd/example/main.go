@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/hashicorp/memberlist"
 	"github.com/misalcedo/gedcb"
+	"github.com/misalcedo/gedcb/gossip"
 	"io"
 	"log"
 	"net/http"
@@ -17,181 +19,217 @@ import (
 	"time"
 )
 
+// shutdownTimeout bounds each step of the node's shutdown.
+const shutdownTimeout = 5 * time.Second
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	defer stop()
 
-	var address, cluster, name, peers string
+	var address, breakers, cluster, name, peers, zone string
 	var gossipPort, httpPort int
+	var aggregate bool
 
 	flag.StringVar(&name, "name", "", "name of the current node")
 	flag.StringVar(&address, "address", "", "address of the current node")
 	flag.StringVar(&cluster, "cluster", "", "address of the cluster")
 	flag.StringVar(&peers, "peers", "", "list of peers to join the cluster")
+	flag.StringVar(&breakers, "breakers", defaultBreaker, "list of breakers requests can use")
+	flag.StringVar(&zone, "zone", "", "availability zone of the current node")
 	flag.IntVar(&gossipPort, "gossipPort", 7946, "port for the node to gossip on")
 	flag.IntVar(&httpPort, "httpPort", 8080, "port of the node to start the HTTP server on")
+	flag.BoolVar(&aggregate, "aggregate", false, "gossip decayed counts and trip on the cluster-wide failure rate")
 	flag.Parse()
 
-	config := memberlist.DefaultLANConfig()
+	config := gossip.DefaultConfig()
 
 	if name != "" {
-		config.Name = name
+		config.Memberlist.Name = name
 	}
 
 	if address != "" {
-		config.BindAddr = address
+		config.Memberlist.BindAddr = address
+	}
+
+	config.Memberlist.Label = cluster
+	config.Memberlist.BindPort = gossipPort
+	config.Memberlist.DeadNodeReclaimTime = 5 * time.Minute
+	config.Memberlist.ProtocolVersion = memberlist.ProtocolVersionMax
+	config.Memberlist.DelegateProtocolVersion = memberlist.ProtocolVersionMax
+	config.Memberlist.DelegateProtocolMin = memberlist.ProtocolVersion2Compatible
+	config.Memberlist.DelegateProtocolMax = memberlist.ProtocolVersionMax
+	config.Memberlist.LogOutput = io.Discard
+	config.Breaker.ClusterAggregate = aggregate
+	config.Breaker.OnTransition = func(change gedcb.StateChange) {
+		log.Printf("breaker changed state %v\n", change)
 	}
+	config.Cluster = cluster
+	config.Zone = zone
+	config.Peers = strings.Fields(peers)
+	config.Breakers = make(map[string]gedcb.BreakerConfig)
 
-	config.Label = cluster
-	config.BindPort = gossipPort
-	config.DeadNodeReclaimTime = 5 * time.Minute
-	config.ProtocolVersion = memberlist.ProtocolVersionMax
-	config.DelegateProtocolVersion = memberlist.ProtocolVersionMax
-	config.DelegateProtocolMin = memberlist.ProtocolVersion2Compatible
-	config.DelegateProtocolMax = memberlist.ProtocolVersionMax
-	config.LogOutput = io.Discard
+	for _, breaker := range strings.Fields(breakers) {
+		config.Breakers[breaker] = config.Breaker
+	}
 
-	log.SetPrefix(fmt.Sprintf("[%s] ", config.Name))
+	log.SetPrefix(fmt.Sprintf("[%s] ", config.Memberlist.Name))
 
-	delegate, err := NewBreakerDelegate(config)
+	node, err := gossip.NewCluster(config)
 	if err != nil {
-		log.Fatalln("failed to create memberlist", err)
+		log.Fatalln("failed to create cluster", err)
 	}
 
-	go joinCluster(ctx, delegate, cluster, peers)
-	go gossip(ctx, delegate)
-	launchServer(httpPort, delegate.Breaker())
-}
+	if err = node.Start(ctx); err != nil {
+		log.Fatalln("failed to create memberlist", err)
+	}
 
-func gossip(ctx context.Context, delegate *ClusterDelegate) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	go func() {
+		if err := node.JoinLoop(ctx); err != nil && ctx.Err() == nil {
+			log.Println("stopped joining the cluster", err)
+		}
+	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			if err := delegate.cluster.Leave(time.Second); err != nil {
-				log.Fatalln("failed to gracefully leave the cluster", err)
-			}
+	server := newServer(httpPort, node, config.Breakers)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
 
-			if err := delegate.cluster.Shutdown(); err != nil {
-				log.Fatalln("failed to shutdown gossip listeners", err)
-			}
+	<-ctx.Done()
+	stop()
 
-			return
-		case <-ticker.C:
-			self := delegate.cluster.LocalNode()
-			log.Println("Alive members:")
-			for _, member := range delegate.cluster.Members() {
-				if member == self {
-					continue
-				}
-
-				log.Printf("- %s\n", member.Name)
-			}
-		}
+	if err := withTimeout(node.Leave); err != nil {
+		log.Println("failed to gracefully leave the cluster", err)
 	}
-}
-
-func joinCluster(ctx context.Context, delegate *ClusterDelegate, cluster string, peers string) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
 
-	err := delegate.Join(cluster, strings.Fields(peers))
-	if err != nil {
-		log.Println("failed to join cluster", err)
+	if err := withTimeout(server.Shutdown); err != nil {
+		log.Println("failed to gracefully shutdown the HTTP server", err)
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			err = delegate.Join(cluster, strings.Fields(peers))
-			if err != nil {
-				log.Println("failed to join cluster", err)
-			}
-
-			// once we succeed do check less often
-			ticker.Reset(time.Minute)
-		}
+	if err := withTimeout(node.Shutdown); err != nil {
+		log.Fatalln("failed to shutdown gossip listeners", err)
 	}
 }
 
+// withTimeout calls f with a context that expires after the shutdown timeout.
+func withTimeout(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return f(ctx)
+}
+
 type Response struct {
 	State     gedcb.State
 	Successes int
 	Failures  int
+	Reason    string
 }
 
-func launchServer(port int, breaker *gedcb.Breaker) {
+// defaultBreaker is the breaker used by requests that do not name one.
+const defaultBreaker = "default"
+
+// newServer creates the HTTP server of the node's breakers. Requests name a breaker with the breaker query parameter,
+// and only the breakers created on startup can be named.
+func newServer(port int, node *gossip.Cluster, breakers map[string]gedcb.BreakerConfig) *http.Server {
+	lookup := func(r *http.Request) (*gedcb.Breaker, bool) {
+		name := r.URL.Query().Get("breaker")
+		if name == "" {
+			name = defaultBreaker
+		}
+
+		if _, found := breakers[name]; !found {
+			return nil, false
+		}
+
+		return node.Breaker(name), true
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/success", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := lookup(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
 		now := time.Now()
 
 		if err := breaker.Success(now); err != nil {
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 
-		response, err := json.Marshal(Response{
-			State:     breaker.State(now),
-			Successes: breaker.Successes(now),
-			Failures:  breaker.Failures(now),
-		})
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-
-		_, err = io.Copy(w, bytes.NewReader(response))
-		if err != nil {
-			log.Println("failed to write response", err)
-		}
+		writeState(w, breaker, now)
 	})
 	mux.HandleFunc("/failure", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := lookup(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
 		now := time.Now()
 
-		if err := breaker.Failure(now); err != nil {
+		if err := breaker.Failure(now, r.URL.Query()["key"]...); err != nil {
 			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 
-		response, err := json.Marshal(Response{
-			State:     breaker.State(now),
-			Successes: breaker.Successes(now),
-			Failures:  breaker.Failures(now),
-		})
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		writeState(w, breaker, now)
+	})
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := lookup(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
 		}
 
-		_, err = io.Copy(w, bytes.NewReader(response))
-		if err != nil {
-			log.Println("failed to write response", err)
-		}
+		writeState(w, breaker, time.Now())
 	})
-	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
-		now := time.Now()
+	mux.HandleFunc("/failures", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := lookup(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
 
-		response, err := json.Marshal(Response{
-			State:     breaker.State(now),
-			Successes: breaker.Successes(now),
-			Failures:  breaker.Failures(now),
-		})
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, breaker.ClusterTopFailures(time.Now()))
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		status := node.JoinStatus()
+		if !status.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 
-		_, err = io.Copy(w, bytes.NewReader(response))
-		if err != nil {
+		if _, err := fmt.Fprintln(w, status); err != nil {
 			log.Println("failed to write response", err)
 		}
 	})
-	server := &http.Server{
+	return &http.Server{
 		Addr:    fmt.Sprintf("0.0.0.0:%d", port),
 		Handler: mux,
 	}
+}
+
+// writeState writes the breaker's state and counts at the given time as JSON.
+func writeState(w http.ResponseWriter, breaker *gedcb.Breaker, now time.Time) {
+	writeJSON(w, Response{
+		State:     breaker.State(now),
+		Successes: breaker.Successes(now),
+		Failures:  breaker.Failures(now),
+		Reason:    breaker.LastStateChange().Reason,
+	})
+}
+
+// writeJSON writes the value as JSON.
+func writeJSON(w http.ResponseWriter, value any) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 
-	err := server.ListenAndServe()
+	_, err = io.Copy(w, bytes.NewReader(response))
 	if err != nil {
-		log.Fatalln(err)
+		log.Println("failed to write response", err)
 	}
 }
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/misalcedo/gedcb/gossip"
+	"github.com/misalcedo/gedcb/gossip/kubernetes"
+	"io"
+	"log"
+	"net/http"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	var address, breakers, cluster, endpointSlices, keyring, name, peers, peersFile, signingKey, srv, trust, voting, zone string
+	var expectedMembers, gossipPort, httpPort, maxBreakers, maxPeerHealth int
+	var openQuorum, partitionThreshold float64
+	var aggregate, deferUnhealthy bool
+	var activityWindow, deadMemberTimeout, drainTimeout, holdTime, keyringInterval, opinionTTL, probeTimeout, remoteOpenDuration, shutdownTimeout time.Duration
+	var damping bool
+
+	flag.StringVar(&name, "name", "", "name of the current node")
+	flag.StringVar(&address, "address", "", "address of the current node")
+	flag.StringVar(&cluster, "cluster", "", "address of the cluster")
+	flag.StringVar(&peers, "peers", "", "list of peers to join the cluster")
+	flag.StringVar(&peersFile, "peersFile", "", "file listing peers to join the cluster, watched for changes")
+	flag.StringVar(&srv, "srv", "", "DNS name whose SRV records list the peers to join the cluster")
+	flag.StringVar(&endpointSlices, "endpointSlices", "", "namespace/service whose Kubernetes EndpointSlices list the peers to join the cluster")
+	flag.StringVar(&breakers, "breakers", defaultBreaker, "list of breakers to create on startup")
+	flag.StringVar(&zone, "zone", "", "availability zone of the current node")
+	flag.StringVar(&voting, "voting", "simple", "voting policy of the breakers: simple, zone-majority or zone-quorum:K")
+	flag.StringVar(&keyring, "keyring", "", "file or secret mount directory with the base64 keys that encrypt gossip")
+	flag.DurationVar(&keyringInterval, "keyringInterval", gossip.DefaultConfig().KeyringInterval, "how often the keyring is read again to apply rotated keys")
+	flag.StringVar(&signingKey, "signingKey", "", "file with the base64 ed25519 key that signs the node's opinions")
+	flag.StringVar(&trust, "trust", "", "file of node names and base64 ed25519 public keys that must sign their opinions")
+	flag.IntVar(&gossipPort, "gossipPort", 7946, "port for the node to gossip on")
+	flag.IntVar(&httpPort, "httpPort", 8080, "port of the node to start the HTTP server on")
+	flag.IntVar(&maxBreakers, "maxBreakers", 100, "most breakers the node has, including the ones requests create by name, zero for no limit")
+	flag.IntVar(&expectedMembers, "expectedMembers", 0, "expected size of the cluster, zero to learn it from the most members seen alive")
+	flag.Float64Var(&partitionThreshold, "partitionThreshold", gossip.DefaultConfig().PartitionThreshold, "fraction of the expected members that must be alive for breakers to count their peers, zero to always count them")
+	flag.DurationVar(&deadMemberTimeout, "deadMemberTimeout", gossip.DefaultConfig().DeadMemberTimeout, "how long a failed member counts towards the expected size of the cluster, zero to count it until it leaves")
+	flag.Float64Var(&openQuorum, "openQuorum", 0, "fraction of the peers that must be open to open the breaker right away, zero to only open on the peers' suspicion")
+	flag.DurationVar(&remoteOpenDuration, "remoteOpenDuration", 0, "how long breakers opened by the open quorum stay in RemoteOpen, zero to fully open them")
+	flag.DurationVar(&probeTimeout, "probeTimeout", 0, "how long breakers in HalfOpen wait for the elected prober's result before probing on their own, zero to always probe on their own")
+	flag.IntVar(&maxPeerHealth, "maxPeerHealth", 0, "Lifeguard health score at which a peer's vote is ignored, zero to only down-weight it")
+	flag.BoolVar(&aggregate, "aggregate", false, "gossip decayed counts and trip on the cluster-wide failure rate")
+	flag.BoolVar(&deferUnhealthy, "deferUnhealthy", false, "defer to peers instead of opening on local failures while the node is unhealthy")
+	flag.DurationVar(&activityWindow, "activityWindow", 0, "how long after its last call a node votes on a downstream's breaker, zero to always vote")
+	flag.DurationVar(&holdTime, "holdTime", gossip.DefaultDampingConfig().MinHoldTime, "minimum time a broadcast state stays advertised before a change other than to Open is broadcast")
+	flag.BoolVar(&damping, "damping", true, "suppress the broadcasts of flapping breakers, except when they open")
+	flag.DurationVar(&drainTimeout, "drainTimeout", 5*time.Second, "how long to wait for the node's final state to be gossiped on shutdown")
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", 5*time.Second, "how long to wait for HTTP requests to finish on shutdown, and again for gossip to stop")
+	flag.DurationVar(&opinionTTL, "opinionTTL", gossip.DefaultConfig().OpinionTTL, "how long a peer's opinion counts without a heartbeat, zero to keep it until the peer leaves")
+	flag.Parse()
+
+	config := gossip.DefaultConfig()
+
+	if name != "" {
+		config.Memberlist.Name = name
+	}
+
+	if address != "" {
+		config.Memberlist.BindAddr = address
+	}
+
+	config.Memberlist.Label = cluster
+	config.Memberlist.BindPort = gossipPort
+	config.Memberlist.DeadNodeReclaimTime = 5 * time.Minute
+	config.Memberlist.ProtocolVersion = memberlist.ProtocolVersionMax
+	config.Memberlist.DelegateProtocolVersion = memberlist.ProtocolVersionMax
+	config.Memberlist.DelegateProtocolMin = memberlist.ProtocolVersion2Compatible
+	config.Memberlist.DelegateProtocolMax = memberlist.ProtocolVersionMax
+	config.Memberlist.LogOutput = io.Discard
+	config.Breaker.ClusterAggregate = aggregate
+	config.Breaker.ActivityWindow = activityWindow
+	config.Breaker.MaxPeerHealthScore = maxPeerHealth
+	config.Breaker.OpenQuorum = openQuorum
+	config.Breaker.RemoteOpenDuration = remoteOpenDuration
+	config.Breaker.ProbeTimeout = probeTimeout
+	config.Breaker.DeferWhenUnhealthy = deferUnhealthy
+	config.OpinionTTL = opinionTTL
+	config.Damping.MinHoldTime = holdTime
+	config.ExpectedMembers = expectedMembers
+	config.PartitionThreshold = partitionThreshold
+	config.DeadMemberTimeout = deadMemberTimeout
+	if !damping {
+		config.Damping.Penalty = 0
+	}
+	config.Breaker.OnTransition = func(change gedcb.StateChange) {
+		log.Printf("breaker changed state %v\n", change)
+	}
+	config.Cluster = cluster
+	config.Zone = zone
+	config.KeyringPath = keyring
+	config.KeyringInterval = keyringInterval
+	config.TrustPath = trust
+	config.Peers = strings.Fields(peers)
+
+	policy, err := gedcb.ParseVotingPolicy(voting)
+	if err != nil {
+		log.Fatalln("failed to parse voting policy", err)
+	}
+
+	// the breaker configuration must be complete before the startup breakers copy it.
+	config.Breaker.VotingPolicy = policy
+	config.Breakers = make(map[string]gedcb.BreakerConfig)
+
+	for _, breaker := range strings.Fields(breakers) {
+		config.Breakers[breaker] = config.Breaker
+	}
+
+	config.Discovery, err = peerDiscovery(config, peersFile, srv, endpointSlices)
+	if err != nil {
+		log.Fatalln("failed to configure peer discovery", err)
+	}
+
+	if signingKey != "" {
+		key, err := gossip.LoadSigningKey(signingKey)
+		if err != nil {
+			log.Fatalln("failed to load signing key", err)
+		}
+
+		config.SigningKey = key
+		config.RequireSignatures = true
+	}
+
+	log.SetPrefix(fmt.Sprintf("[%s] ", config.Memberlist.Name))
+	log.Printf("using decay function %s\n", config.Decay)
+
+	node, err := gossip.NewCluster(config)
+	if err != nil {
+		log.Fatalln("failed to create cluster", err)
+	}
+
+	if err = node.Start(ctx); err != nil {
+		log.Fatalln("failed to create memberlist", err)
+	}
+
+	go func() {
+		if err := node.JoinLoop(ctx); err != nil && ctx.Err() == nil {
+			log.Println("stopped joining the cluster", err)
+		}
+	}()
+	go logMembers(ctx, node)
+
+	server := newServer(httpPort, &breakerLimiter{node: node, max: maxBreakers})
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln(err)
+		}
+	}()
+
+	<-ctx.Done()
+	// a second signal stops the node without draining.
+	stop()
+	drain(node, server, drainTimeout, shutdownTimeout)
+}
+
+// drain tells peers to stop counting the node's opinions and leaves the cluster within the drain timeout, then stops serving HTTP requests
+// and gossiping within the shutdown timeout each, so that a slow handoff does not cut in-flight requests short.
+func drain(node *gossip.Cluster, server *http.Server, drainTimeout, shutdownTimeout time.Duration) {
+	if err := withTimeout(drainTimeout, node.Leave); err != nil {
+		log.Println("failed to gracefully leave the cluster", err)
+	}
+
+	if err := withTimeout(shutdownTimeout, server.Shutdown); err != nil {
+		log.Println("failed to gracefully shutdown the HTTP server", err)
+	}
+
+	if err := withTimeout(shutdownTimeout, node.Shutdown); err != nil {
+		log.Fatalln("failed to shutdown gossip listeners", err)
+	}
+}
+
+// withTimeout calls f with a context that expires after the timeout.
+func withTimeout(timeout time.Duration, f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return f(ctx)
+}
+
+// peerDiscovery combines the cluster's DNS name or static peers with the other configured discovery providers, if any.
+func peerDiscovery(config gossip.Config, peersFile, srv, endpointSlices string) (gossip.Discovery, error) {
+	if peersFile == "" && srv == "" && endpointSlices == "" {
+		return nil, nil
+	}
+
+	var providers gossip.CompositeDiscovery
+	if config.Cluster != "" && config.Cluster != "localhost" {
+		providers = append(providers, gossip.DNSDiscovery{Name: config.Cluster, Port: config.Memberlist.BindPort})
+	}
+
+	if len(config.Peers) > 0 {
+		providers = append(providers, gossip.StaticPeers(config.Peers))
+	}
+
+	if peersFile != "" {
+		providers = append(providers, gossip.FileDiscovery{Path: peersFile})
+	}
+
+	if srv != "" {
+		providers = append(providers, gossip.SRVDiscovery{Name: srv})
+	}
+
+	if endpointSlices != "" {
+		namespace, service, found := strings.Cut(endpointSlices, "/")
+		if !found {
+			return nil, fmt.Errorf("expected namespace/service, got %q", endpointSlices)
+		}
+
+		slices, err := kubernetes.InCluster(namespace, service, config.Memberlist.BindPort)
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, slices)
+	}
+
+	return providers, nil
+}
+
+func logMembers(ctx context.Context, node *gossip.Cluster) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			self := node.LocalNode()
+			log.Println("Alive members:")
+			for _, member := range node.Members() {
+				if member.Name == self.Name {
+					continue
+				}
+
+				meta, _ := node.PeerMeta(member.Name)
+				log.Printf("- %s (zone %q, breakers %v)\n", member.Name, meta.Zone, meta.Breakers)
+			}
+		}
+	}
+}
+
+type Response struct {
+	State     gedcb.State
+	Successes int
+	Failures  int
+	Reason    string
+}
+
+// defaultBreaker is the breaker used by requests that do not name one.
+const defaultBreaker = "default"
+
+// breakerName returns the breaker named by the request's breaker query parameter, or of the downstream named by its downstream parameter.
+func breakerName(r *http.Request) string {
+	if name := r.URL.Query().Get("breaker"); name != "" {
+		return name
+	}
+
+	if downstream := r.URL.Query().Get("downstream"); downstream != "" {
+		return gossip.DownstreamName(downstream)
+	}
+
+	return defaultBreaker
+}
+
+// maxBreakerName is the longest breaker name requests may use.
+const maxBreakerName = 256
+
+// breakerLimiter creates the breakers named by requests up to a maximum count, breakers created on startup included, so that clients
+// cannot grow the node's memory and gossip state without bound.
+type breakerLimiter struct {
+	node  *gossip.Cluster
+	max   int
+	mutex sync.Mutex
+}
+
+// breaker returns the breaker named by the request, creating it if the limit allows. It returns false if the name is too long,
+// or if the breaker does not exist and the limit is reached.
+func (l *breakerLimiter) breaker(r *http.Request) (*gedcb.Breaker, bool) {
+	name := breakerName(r)
+	if len(name) > maxBreakerName {
+		return nil, false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if names := l.node.Breakers(); l.max > 0 && len(names) >= l.max && !slices.Contains(names, name) {
+		return nil, false
+	}
+
+	return l.node.Breaker(name), true
+}
+
+// newServer creates the HTTP server of the node's breakers and cluster.
+func newServer(port int, breakers *breakerLimiter) *http.Server {
+	node := breakers.node
+	mux := http.NewServeMux()
+	mux.HandleFunc("/success", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := breakers.breaker(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now()
+
+		if err := breaker.Success(now); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		response, err := json.Marshal(Response{
+			State:     breaker.State(now),
+			Successes: breaker.Successes(now),
+			Failures:  breaker.Failures(now),
+			Reason:    breaker.LastStateChange().Reason,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/failure", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := breakers.breaker(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now()
+
+		if err := breaker.Failure(now, r.URL.Query()["key"]...); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		response, err := json.Marshal(Response{
+			State:     breaker.State(now),
+			Successes: breaker.Successes(now),
+			Failures:  breaker.Failures(now),
+			Reason:    breaker.LastStateChange().Reason,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := breakers.breaker(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
+		now := time.Now()
+
+		response, err := json.Marshal(Response{
+			State:     breaker.State(now),
+			Successes: breaker.Successes(now),
+			Failures:  breaker.Failures(now),
+			Reason:    breaker.LastStateChange().Reason,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/cluster", func(w http.ResponseWriter, r *http.Request) {
+		view, found := node.View(breakerName(r))
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "text" || strings.HasPrefix(r.Header.Get("Accept"), "text/plain") {
+			if err := view.WriteTable(w); err != nil {
+				log.Println("failed to write response", err)
+			}
+			return
+		}
+
+		response, err := json.Marshal(view)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/failures", func(w http.ResponseWriter, r *http.Request) {
+		breaker, found := breakers.breaker(r)
+		if !found {
+			http.Error(w, "unknown breaker", http.StatusNotFound)
+			return
+		}
+
+		response, err := json.Marshal(breaker.ClusterTopFailures(time.Now()))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		status := node.JoinStatus()
+		if !status.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if _, err := fmt.Fprintln(w, status); err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		keys, err := node.ListKeys()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		fingerprints := make([]string, 0, len(keys))
+		for _, key := range keys {
+			fingerprints = append(fingerprints, gossip.KeyFingerprint(key))
+		}
+
+		response, err := json.Marshal(fingerprints)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(response))
+		if err != nil {
+			log.Println("failed to write response", err)
+		}
+	})
+	return &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", port),
+		Handler: mux,
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/misalcedo/gedcb/phasea"
+)
+
+// defaultBreaker is the breaker used by requests that do not name one.
+const defaultBreaker = "default"
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	config := phasea.DefaultConfig()
+
+	var address, breakers, peers string
+	var httpPort int
+
+	hostname, _ := os.Hostname()
+
+	flag.StringVar(&config.Name, "name", hostname, "name of the current node")
+	flag.StringVar(&address, "address", "0.0.0.0:7947", "UDP address for the node to gossip on")
+	flag.StringVar(&peers, "peers", "", "list of the UDP addresses of the gossip set")
+	flag.StringVar(&breakers, "breakers", defaultBreaker, "list of breakers to create on startup")
+	flag.DurationVar(&config.Period, "period", config.Period, "time between gossip rounds")
+	flag.IntVar(&config.Fanout, "fanout", config.Fanout, "number of peers to gossip with every round")
+	flag.IntVar(&config.AgeLimit, "ageLimit", config.AgeLimit, "number of rounds after which an opinion no longer votes")
+	flag.IntVar(&httpPort, "httpPort", 8080, "port of the node to start the HTTP server on")
+	flag.Parse()
+
+	transport, err := phasea.NewUDPTransport(address)
+	if err != nil {
+		log.Fatalln("failed to listen for gossip", err)
+	}
+
+	config.Transport = transport
+	config.Peers = strings.Fields(peers)
+	config.Breaker.OnTransition = func(change gedcb.StateChange) {
+		log.Printf("breaker changed state %v\n", change)
+	}
+	config.Breakers = make(map[string]gedcb.BreakerConfig)
+
+	for _, breaker := range strings.Fields(breakers) {
+		config.Breakers[breaker] = config.Breaker
+	}
+
+	log.SetPrefix(fmt.Sprintf("[%s] ", config.Name))
+
+	engine, err := phasea.NewEngine(config)
+	if err != nil {
+		log.Fatalln("failed to create gossip engine", err)
+	}
+
+	if err = engine.Start(ctx); err != nil {
+		log.Fatalln("failed to start gossip engine", err)
+	}
+
+	go launchServer(httpPort, engine)
+
+	<-ctx.Done()
+
+	if err = engine.Shutdown(context.Background()); err != nil {
+		log.Fatalln("failed to shutdown gossip engine", err)
+	}
+}
+
+type Response struct {
+	State     gedcb.State
+	Successes int
+	Failures  int
+	Reason    string
+}
+
+// breakerName returns the breaker named by the request's breaker query parameter.
+func breakerName(r *http.Request) string {
+	if name := r.URL.Query().Get("breaker"); name != "" {
+		return name
+	}
+
+	return defaultBreaker
+}
+
+func launchServer(port int, engine *phasea.Engine) {
+	// record applies the request's outcome, if any, to its breaker and responds with the breaker's state.
+	record := func(outcome func(breaker *gedcb.Breaker, r *http.Request, now time.Time) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			breaker := engine.Breaker(breakerName(r))
+			now := time.Now()
+
+			if outcome != nil {
+				if err := outcome(breaker, r, now); err != nil {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}
+
+			writeJSON(w, Response{
+				State:     breaker.State(now),
+				Successes: breaker.Successes(now),
+				Failures:  breaker.Failures(now),
+				Reason:    breaker.LastStateChange().Reason,
+			})
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/success", record(func(breaker *gedcb.Breaker, r *http.Request, now time.Time) error {
+		return breaker.Success(now)
+	}))
+	mux.HandleFunc("/failure", record(func(breaker *gedcb.Breaker, r *http.Request, now time.Time) error {
+		return breaker.Failure(now, r.URL.Query()["key"]...)
+	}))
+	mux.HandleFunc("/state", record(nil))
+	mux.HandleFunc("/gossip", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, struct {
+			Opinions []phasea.Opinion
+			Stats    phasea.Stats
+		}{engine.State(), engine.Stats()})
+	})
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", port),
+		Handler: mux,
+	}
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	response, err := json.Marshal(value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(response); err != nil {
+		log.Println("failed to write response", err)
+	}
+}
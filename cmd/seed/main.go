@@ -98,7 +98,7 @@ func main() {
 	}
 
 	// Don't join a cluster of just the current pod.
-	slices.DeleteFunc(seeds, func(s string) bool {
+	seeds = slices.DeleteFunc(seeds, func(s string) bool {
 		return strings.HasPrefix(s, config.Name)
 	})
 
@@ -122,7 +122,7 @@ func main() {
 		case <-time.Tick(time.Second):
 			if list.NumMembers() < len(seeds) {
 				log.Printf("Reseeding due to low member count: %d\n", list.NumMembers())
-				rand.Shuffle(len(peers), func(i, j int) {
+				rand.Shuffle(len(seeds), func(i, j int) {
 					seeds[i], seeds[j] = seeds[j], seeds[i]
 				})
 				_, err = list.Join(seeds)
@@ -1,19 +1,37 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/misalcedo/gedcb"
 	"math/rand"
+	"os"
 	"time"
 )
 
+type decaySpec struct {
+	gedcb.DecaySpec
+}
+
+// String is an implementation of the flag.Value interface
+func (d *decaySpec) String() string {
+	return d.DecaySpec.String()
+}
+
+// Set is an implementation of the flag.Value interface
+func (d *decaySpec) Set(value string) error {
+	return json.Unmarshal([]byte(value), &d.DecaySpec)
+}
+
 func main() {
 	var requests int
 	var availability float64
+	spec := decaySpec{gedcb.ExponentialDecaySpec(0.1, time.Minute)}
 
 	flag.IntVar(&requests, "requests", 100_000, "Number of requests")
 	flag.Float64Var(&availability, "availability", 1.0, "Probability of a given request succeeding")
+	flag.Var(&spec, "decay", `JSON spec of the decay function, e.g. {"name":"step","params":{"factor":0.5,"interval":60}}`)
 	flag.Parse()
 
 	config := gedcb.BreakerConfig{
@@ -25,7 +43,13 @@ func main() {
 		HalfOpenSuccessThreshold:  2,
 		OpenDuration:              time.Second * 1,
 	}
-	decay := gedcb.NewDecay(time.Now(), gedcb.ExponentialDecayFunction(0.1, config.WindowSize))
+	decay, err := gedcb.NewDecayFromSpec(time.Now(), spec.DecaySpec)
+	if err != nil {
+		fmt.Printf("Invalid decay function: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Simulating %d requests with decay function %s\n", requests, decay.Spec())
 	breaker := gedcb.NewBreaker(config, decay)
 
 	rejected := 0
@@ -8,6 +8,7 @@ import (
 type ForwardDecay struct {
 	landmark time.Time
 	g        func(time.Duration) float64
+	spec     DecaySpec
 }
 
 type Item interface {
@@ -37,13 +38,22 @@ func (t BasicItem) Value() float64 {
 	return t.value
 }
 
+// ExponentialDecayFunction decays an item's weight to target (between 0 and 1) after interval.
+// Earlier versions negated the exponent, so older items weighed up to 1/target times more than new ones instead of less.
 func ExponentialDecayFunction(target float64, interval time.Duration) G {
-	alpha := math.Log(target) / interval.Seconds()
+	alpha := -math.Log(target) / interval.Seconds()
 	return func(duration time.Duration) float64 {
 		return math.Exp(alpha * duration.Seconds())
 	}
 }
 
+// SlidingExponentialDecayFunction decays an item's weight by a factor of e every window, like an exponentially weighted moving average with the window as its time constant.
+func SlidingExponentialDecayFunction(window time.Duration) G {
+	return func(duration time.Duration) float64 {
+		return math.Exp(duration.Seconds() / window.Seconds())
+	}
+}
+
 func LinearDecayFunction(m float64, b float64) G {
 	return func(duration time.Duration) float64 {
 		return (m * duration.Seconds()) + b
@@ -56,6 +66,28 @@ func PolynomialDecayFunction(beta float64) G {
 	}
 }
 
+// ShiftedPolynomialDecayFunction is PolynomialDecayFunction shifted by one second, (1+t)^beta with t in seconds, so that items at the landmark keep a weight of 1.
+func ShiftedPolynomialDecayFunction(beta float64) G {
+	return func(duration time.Duration) float64 {
+		return math.Pow(1+duration.Seconds(), beta)
+	}
+}
+
+// StepDecayFunction keeps an item's weight constant within each interval and multiplies it by factor (between 0 and 1) at every interval boundary.
+func StepDecayFunction(factor float64, interval time.Duration) G {
+	return func(duration time.Duration) float64 {
+		return math.Pow(factor, -math.Floor(duration.Seconds()/interval.Seconds()))
+	}
+}
+
+// NoDecayFunction gives every item the same weight regardless of its age.
+func NoDecayFunction() G {
+	return func(time.Duration) float64 {
+		return 1
+	}
+}
+
+// NewDecay creates a forward decay with the given landmark. The decay's Spec is empty because g is opaque; use NewDecayFromSpec to keep it.
 func NewDecay(now time.Time, g G) ForwardDecay {
 	return ForwardDecay{
 		landmark: now,
@@ -63,6 +95,11 @@ func NewDecay(now time.Time, g G) ForwardDecay {
 	}
 }
 
+// Spec returns the spec the decay was created from, or an empty spec if it was created from an opaque function.
+func (d ForwardDecay) Spec() DecaySpec {
+	return d.spec.clone()
+}
+
 func (d ForwardDecay) Landmark() time.Time {
 	return d.landmark
 }
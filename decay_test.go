@@ -33,3 +33,16 @@ func TestNewDecay(t *testing.T) {
 		t.Errorf("got %v\nexpected %v", actual, expected)
 	}
 }
+
+func TestExponentialDecayFavorsNewerItems(t *testing.T) {
+	landmark := time.Now()
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.5, time.Minute))
+	now := landmark.Add(2 * time.Minute)
+
+	older := decay.Weight(NewBasicItem(landmark, 1.0), now)
+	newer := decay.Weight(NewBasicItem(landmark.Add(time.Minute), 1.0), now)
+
+	if older >= newer || newer >= 1.0 {
+		t.Errorf("got weights %v for the older item and %v for the newer one, expected older < newer < 1", older, newer)
+	}
+}
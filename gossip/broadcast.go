@@ -0,0 +1,83 @@
+package gossip
+
+import (
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+)
+
+// CircuitBreakerBroadcast carries a node's opinion about one of its breakers, and optionally the breaker's decayed counts, to the rest of the cluster.
+// Opinions are ordered by the node's Incarnation and then by Version, so a restarted node's opinions supersede the ones it sent before restarting.
+// Idle is true if the node has not called the breaker's downstream recently, so its opinion does not count towards the majority.
+// Health is the node's Lifeguard health score when it formed the opinion, zero when healthy, so peers can discount it.
+// Leaving is true once the node is about to leave the cluster, so peers stop counting its opinion before it is gone.
+// Probe is true if State is the outcome of the node's probe in HalfOpen, so peers waiting for it follow it, see gedcb.Breaker.ProbeResult.
+// Failures are the breaker's top failure keys, if it tracks them, so peers can merge them into the cluster's, see gedcb.Breaker.ClusterTopFailures.
+// Signature, if any, is the node's ed25519 signature of the opinion encoded without it.
+type CircuitBreakerBroadcast struct {
+	Node        string
+	Breaker     string
+	Incarnation int64
+	Version     int
+	State       gedcb.State
+	Idle        bool
+	Health      int
+	Leaving     bool
+	Probe       bool
+	Counts      *gedcb.DecayedCounts
+	Failures    *gedcb.DecayedFailures
+	Signature   []byte
+	// received is a signed opinion's message as it was decoded, and signed the part of it the signature covers, so that the signature
+	// is verified over, and the opinion is shared again as, the bytes its node signed rather than a re-encoding by the local version.
+	received []byte
+	signed   []byte
+}
+
+// opinionKey identifies a node's opinion about one of its breakers.
+type opinionKey struct {
+	node    string
+	breaker string
+}
+
+func (c CircuitBreakerBroadcast) key() opinionKey {
+	return opinionKey{node: c.Node, breaker: c.Breaker}
+}
+
+// newerThan returns true if the opinion was sent after the other one by the same node.
+func (c CircuitBreakerBroadcast) newerThan(other CircuitBreakerBroadcast) bool {
+	if c.Incarnation != other.Incarnation {
+		return c.Incarnation > other.Incarnation
+	}
+
+	return c.Version > other.Version
+}
+
+// broadcast queues an encoded CircuitBreakerBroadcast with memberlist.
+// Encoding happens before queueing so that a message that fails to encode is never sent.
+type broadcast struct {
+	opinion CircuitBreakerBroadcast
+	message []byte
+}
+
+func newBroadcast(opinion CircuitBreakerBroadcast) (*broadcast, error) {
+	message, err := opinion.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &broadcast{opinion: opinion, message: message}, nil
+}
+
+func (b *broadcast) Invalidates(other memberlist.Broadcast) bool {
+	if old, ok := other.(*broadcast); ok {
+		return b.opinion.key() == old.opinion.key() && !old.opinion.newerThan(b.opinion)
+	}
+
+	return false
+}
+
+func (b *broadcast) Message() []byte {
+	return b.message
+}
+
+func (b *broadcast) Finished() {
+}
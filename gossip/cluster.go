@@ -0,0 +1,606 @@
+// Package gossip shares the state of named gedcb.Breaker instances with the other members of a memberlist cluster,
+// so that each breaker can open when the majority of its peers suspect a failure.
+package gossip
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+)
+
+// Defaults of the join settings left unset in a Config.
+const (
+	defaultJoinPeers    = 3
+	defaultJoinRetryMin = time.Second
+	defaultJoinRetryMax = time.Minute
+)
+
+// NotStartedErr is returned by operations that require the cluster to be started.
+var NotStartedErr = errors.New("cluster not started")
+
+// AlreadyStartedErr is returned when starting a cluster more than once.
+var AlreadyStartedErr = errors.New("cluster already started")
+
+// Config configures a Cluster.
+type Config struct {
+	// Memberlist configures the gossip layer. Its Delegate, Events and Alive are replaced by the cluster.
+	Memberlist *memberlist.Config
+	// Breaker configures the breakers created on first use by Cluster.Breaker. OnStateChange is still called on every state change.
+	Breaker gedcb.BreakerConfig
+	// Breakers are created along with the cluster, each with its own configuration.
+	Breakers map[string]gedcb.BreakerConfig
+	// Decay describes the breakers' decay function.
+	Decay gedcb.DecaySpec
+	// Cluster is a DNS name resolving to the IP addresses of the cluster's members.
+	Cluster string
+	// Peers are the addresses of known members, used when Cluster is empty or "localhost".
+	Peers []string
+	// Discovery finds the peers to join. It replaces Cluster and Peers when set.
+	// If it is also a Watcher, the cluster joins the new peers it finds as soon as they change.
+	Discovery Discovery
+	// JoinPeers is the number of random discovered peers contacted in parallel by Join. Defaults to three.
+	JoinPeers int
+	// JoinRetryMin and JoinRetryMax bound the exponential backoff of JoinLoop. JoinRetryMax is also how often a joined node joins again.
+	// They default to one second and one minute.
+	JoinRetryMin time.Duration
+	JoinRetryMax time.Duration
+	// CountsInterval is how often breakers' decayed counts and failure keys are gossiped when their ClusterAggregate or FailureKeys are enabled,
+	// how often breakers with an ActivityWindow are checked for becoming idle or active, and how often the local node's health is checked.
+	CountsInterval time.Duration
+	// Zone is the availability zone of the local node, advertised to peers in its NodeMeta.
+	Zone string
+	// Damping limits how often the state of a flapping breaker is broadcast. The zero value only disables suppression, not broadcasts.
+	Damping DampingConfig
+	// MetaInterval is how often the local node's NodeMeta is advertised again if it changed.
+	MetaInterval time.Duration
+	// OpinionTTL is how long a peer's opinion counts without hearing a newer one. Nodes broadcast their opinions again four times per TTL
+	// as a heartbeat, so only the opinions of nodes that stopped gossiping expire. Zero keeps opinions until their node leaves.
+	OpinionTTL time.Duration
+	// ReconcileInterval is how often opinions are checked for expiry, and the opinions of nodes that are no longer members are dropped
+	// in case their leave was missed.
+	ReconcileInterval time.Duration
+	// ExpectedMembers is the size the cluster is expected to have, the local node included. Zero learns it as the most members alive at once,
+	// less the ones that left gracefully since.
+	ExpectedMembers int
+	// PartitionThreshold is the fraction of the expected members the local node must see alive, beyond which it is not partitioned.
+	// Otherwise, its breakers ignore their peers until enough members are alive again, so that a minority of nodes cannot open breakers
+	// on their own majority. Zero disables partition detection.
+	// In a cluster of two, a node that loses its peer is always partitioned, since it cannot tell a partition from its peer failing,
+	// so its breakers decide on their own like a single node would.
+	PartitionThreshold float64
+	// DeadMemberTimeout is how long a member that failed, rather than left gracefully, still counts towards the learned cluster size.
+	// Past it, the cluster is assumed to have shrunk, such as when a crashed node was replaced by one with another name, so a partition
+	// that lasts longer heals as well. Zero keeps counting failed members until ExpectedMembers or a graceful leave lowers the size.
+	DeadMemberTimeout time.Duration
+	// OnPartition is called when the local node becomes partitioned, and again when the partition heals.
+	// Memberlist does not contact members it declared dead again, so a partition only heals once JoinLoop joins the other side again.
+	// It is called from memberlist's event handling, so it must not call back into the cluster.
+	OnPartition func(PartitionChange)
+	// ProbePeriod is how long a member stays the prober of a breaker that coordinates its probes before another one is elected,
+	// so the trial traffic of recurring failures is spread across the cluster. Zero keeps the same prober until the members change.
+	ProbePeriod time.Duration
+	// KeyringPath is a file or directory, such as a mounted Kubernetes secret, holding the keys that encrypt gossip. See LoadKeyring.
+	// When set, it replaces the Memberlist's Keyring and only nodes sharing a key can join the cluster or send it messages.
+	KeyringPath string
+	// KeyringInterval is how often the KeyringPath is read again to apply rotated keys, see Cluster.ReloadKeyring. Zero only reads it once.
+	KeyringInterval time.Duration
+	// SigningKey, if set, signs the local node's opinions. Its public key is advertised in the node's NodeMeta.
+	SigningKey ed25519.PrivateKey
+	// TrustPath is a trust file of nodes' public keys, see LoadTrust. Its keys take precedence over the ones nodes advertise.
+	TrustPath string
+	// RequireSignatures rejects unsigned opinions. Otherwise, only the opinions of nodes with a known public key must be signed.
+	RequireSignatures bool
+	// Logger receives the cluster's log messages. Defaults to the standard logger.
+	Logger *log.Logger
+	// Incarnation distinguishes the runs of a node, so peers prefer its opinions over the ones it sent before restarting.
+	// It must increase with every restart. Defaults to the time the cluster is created, in nanoseconds since the Unix epoch.
+	Incarnation int64
+}
+
+// DefaultConfig returns a configuration suitable for a cluster on a local network.
+func DefaultConfig() Config {
+	breaker := gedcb.BreakerConfig{
+		WindowSize:                  time.Minute,
+		SuspicionSuccessThreshold:   10,
+		SoftFailureThreshold:        5,
+		HardFailureThreshold:        50,
+		HalfOpenFailureThreshold:    2,
+		HalfOpenSuccessThreshold:    2,
+		OpenDuration:                time.Second * 1,
+		FailureKeys:                 10,
+		ClusterFailureRateThreshold: 0.03,
+		ClusterMinimumRequests:      100,
+		ClusterCountsTTL:            time.Minute,
+	}
+
+	return Config{
+		Memberlist:         memberlist.DefaultLANConfig(),
+		Breaker:            breaker,
+		Decay:              gedcb.ExponentialDecaySpec(0.1, breaker.WindowSize),
+		Damping:            DefaultDampingConfig(),
+		CountsInterval:     5 * time.Second,
+		MetaInterval:       5 * time.Second,
+		OpinionTTL:         2 * time.Minute,
+		ReconcileInterval:  10 * time.Second,
+		PartitionThreshold: 0.5,
+		DeadMemberTimeout:  5 * time.Minute,
+		ProbePeriod:        time.Minute,
+		KeyringInterval:    10 * time.Second,
+		Logger:             log.Default(),
+	}
+}
+
+// Cluster gossips the state of a set of named breakers with the other members of a memberlist cluster.
+// Peers' opinions are kept per breaker, so each breaker only counts the votes of peers about the same dependency.
+type Cluster struct {
+	config      Config
+	discovery   Discovery
+	name        string
+	incarnation int64
+	decay       gedcb.ForwardDecay
+	breakers    map[string]*gedcb.Breaker
+	opinions    map[opinionKey]CircuitBreakerBroadcast
+	heard       map[opinionKey]time.Time
+	expired     map[opinionKey]bool
+	peerMeta    map[string]NodeMeta
+	trust       map[string]ed25519.PublicKey
+	leaving     bool
+	live        map[string]bool
+	failed      map[string]time.Time
+	highWater   int
+	partitioned bool
+	probers     map[string]string
+	previous    map[string]string
+	mutex       sync.Mutex
+	dirty       map[string]bool
+	dampers     map[string]*damper
+	dirtyMutex  sync.Mutex
+	keyMutex    sync.Mutex
+	members     *memberlist.Memberlist
+	queue       *memberlist.TransmitLimitedQueue
+	priority    *memberlist.TransmitLimitedQueue
+	stats       stats
+	joinState   joinStatus
+	cancel      context.CancelFunc
+	done        sync.WaitGroup
+}
+
+// NewCluster creates a cluster with the given configuration. Call Start to begin gossiping.
+func NewCluster(config Config) (*Cluster, error) {
+	if config.Memberlist == nil {
+		config.Memberlist = memberlist.DefaultLANConfig()
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+
+	decay, err := gedcb.NewDecayFromSpec(time.Now(), config.Decay)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.KeyringPath != "" {
+		keyring, err := LoadKeyring(config.KeyringPath)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Memberlist.Keyring = keyring
+	}
+
+	if config.SigningKey != nil && len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signing key of %d bytes", len(config.SigningKey))
+	}
+
+	var trust map[string]ed25519.PublicKey
+	if config.TrustPath != "" {
+		if trust, err = LoadTrust(config.TrustPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Damping.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.JoinPeers <= 0 {
+		config.JoinPeers = defaultJoinPeers
+	}
+
+	if config.JoinRetryMin <= 0 {
+		config.JoinRetryMin = defaultJoinRetryMin
+	}
+
+	if config.JoinRetryMax < config.JoinRetryMin {
+		config.JoinRetryMax = max(defaultJoinRetryMax, config.JoinRetryMin)
+	}
+
+	if config.Incarnation == 0 {
+		config.Incarnation = time.Now().UnixNano()
+	}
+
+	if config.Incarnation < 0 {
+		return nil, fmt.Errorf("negative incarnation %d", config.Incarnation)
+	}
+
+	cluster := &Cluster{
+		config:      config,
+		discovery:   config.discovery(),
+		name:        config.Memberlist.Name,
+		incarnation: config.Incarnation,
+		decay:       decay,
+		breakers:    make(map[string]*gedcb.Breaker),
+		dirty:       make(map[string]bool),
+		dampers:     make(map[string]*damper),
+		opinions:    make(map[opinionKey]CircuitBreakerBroadcast),
+		heard:       make(map[opinionKey]time.Time),
+		expired:     make(map[opinionKey]bool),
+		peerMeta:    make(map[string]NodeMeta),
+		trust:       trust,
+		live:        map[string]bool{config.Memberlist.Name: true},
+		failed:      make(map[string]time.Time),
+		highWater:   1,
+		probers:     make(map[string]string),
+		previous:    make(map[string]string),
+	}
+
+	cluster.queue = &memberlist.TransmitLimitedQueue{
+		NumNodes:       cluster.numMembers,
+		RetransmitMult: config.Memberlist.RetransmitMult,
+	}
+	cluster.priority = &memberlist.TransmitLimitedQueue{
+		NumNodes:       cluster.numMembers,
+		RetransmitMult: config.Memberlist.RetransmitMult,
+	}
+
+	for name, breakerConfig := range config.Breakers {
+		cluster.newBreaker(name, breakerConfig)
+	}
+
+	return cluster, nil
+}
+
+// Breaker returns the named breaker, creating it with the configured Breaker if it does not exist yet.
+// The breaker's state is shared with the cluster.
+func (c *Cluster) Breaker(name string) *gedcb.Breaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if breaker, found := c.breakers[name]; found {
+		return breaker
+	}
+
+	return c.newBreaker(name, c.config.Breaker)
+}
+
+// Downstream returns the breaker of a downstream server instance, identified by its host:port address or its service name.
+// Addresses are normalized so that every peer calling the same instance votes on the same breaker.
+func (c *Cluster) Downstream(address string) *gedcb.Breaker {
+	return c.Breaker(DownstreamName(address))
+}
+
+// DownstreamName normalizes a downstream's host:port address or service name into a breaker name.
+func DownstreamName(address string) string {
+	address = strings.TrimSpace(address)
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return strings.ToLower(address)
+	}
+
+	return net.JoinHostPort(strings.TrimSuffix(strings.ToLower(host), "."), port)
+}
+
+// Breakers returns the sorted names of the breakers managed by the cluster.
+func (c *Cluster) Breakers() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	names := make([]string, 0, len(c.breakers))
+	for name := range c.breakers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// newBreaker creates a breaker whose state changes are gossiped to the cluster. The caller must hold the mutex.
+func (c *Cluster) newBreaker(name string, config gedcb.BreakerConfig) *gedcb.Breaker {
+	onStateChange := config.OnStateChange
+	config.OnStateChange = func(oldState, newState gedcb.State) {
+		c.flapped(name, newState)
+
+		if onStateChange != nil {
+			onStateChange(oldState, newState)
+		}
+	}
+
+	decay := c.decay
+	decay.SetLandmark(time.Now())
+
+	breaker := gedcb.NewBreaker(config, decay)
+	c.breakers[name] = breaker
+	breaker.SetLocalHealth(c.healthScore())
+	breaker.SetLocalOnly(c.partitioned)
+	c.electProber(name, breaker, time.Now())
+	c.markDirty(name)
+
+	// opinions about the breaker may have arrived before it was created.
+	for key, opinion := range c.opinions {
+		if key.breaker == name && key.node != c.name && !c.expired[key] {
+			updatePeer(breaker, opinion, c.peerMeta[key.node].Zone)
+		}
+	}
+
+	return breaker
+}
+
+// takeDirty returns the names of the breakers whose state must be broadcast and clears them.
+func (c *Cluster) takeDirty() []string {
+	c.dirtyMutex.Lock()
+	defer c.dirtyMutex.Unlock()
+
+	names := make([]string, 0, len(c.dirty))
+	for name := range c.dirty {
+		names = append(names, name)
+	}
+
+	clear(c.dirty)
+	sort.Strings(names)
+
+	return names
+}
+
+// lookupBreaker returns the named breaker if it exists.
+func (c *Cluster) lookupBreaker(name string) (*gedcb.Breaker, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	breaker, found := c.breakers[name]
+
+	return breaker, found
+}
+
+// eachBreaker calls f for every breaker without holding the mutex, so f may call back into the cluster.
+func (c *Cluster) eachBreaker(f func(name string, breaker *gedcb.Breaker)) {
+	c.mutex.Lock()
+	breakers := make(map[string]*gedcb.Breaker, len(c.breakers))
+	for name, breaker := range c.breakers {
+		breakers[name] = breaker
+	}
+	c.mutex.Unlock()
+
+	for name, breaker := range breakers {
+		f(name, breaker)
+	}
+}
+
+// markDirty queues a broadcast of the named breaker's state on the next gossip round.
+// It uses a separate mutex that is never held while calling into a breaker, so that flapped can be called from the breaker's OnStateChange.
+func (c *Cluster) markDirty(name string) {
+	c.dirtyMutex.Lock()
+	defer c.dirtyMutex.Unlock()
+
+	c.dirty[name] = true
+}
+
+// Stats returns counters of notable gossip events, such as dropped messages.
+func (c *Cluster) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Name returns the name of the local node.
+func (c *Cluster) Name() string {
+	return c.name
+}
+
+// Start creates the memberlist and begins gossiping. Background work stops when the context is done or on Shutdown.
+func (c *Cluster) Start(ctx context.Context) error {
+	if c.members != nil {
+		return AlreadyStartedErr
+	}
+
+	delegate := &delegate{cluster: c}
+	c.config.Memberlist.Delegate = delegate
+	c.config.Memberlist.Events = delegate
+	c.config.Memberlist.Alive = delegate
+
+	members, err := memberlist.Create(c.config.Memberlist)
+	if err != nil {
+		return err
+	}
+
+	c.members = members
+
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	if c.config.CountsInterval > 0 {
+		c.done.Add(1)
+		go c.republish(ctx)
+	}
+
+	if c.config.MetaInterval > 0 {
+		c.done.Add(1)
+		go c.refreshMeta(ctx)
+	}
+
+	if c.config.ReconcileInterval > 0 {
+		c.done.Add(1)
+		go c.reconcile(ctx)
+	}
+
+	if c.config.KeyringPath != "" && c.config.KeyringInterval > 0 {
+		c.done.Add(1)
+		go c.reloadKeyring(ctx)
+	}
+
+	if watcher, ok := c.discovery.(Watcher); ok {
+		c.done.Add(1)
+		go c.watchPeers(ctx, watcher.Watch(ctx))
+	}
+
+	return nil
+}
+
+// Leave hands off the local node's final state and broadcasts its intent to leave the cluster.
+// First, it broadcasts a leaving opinion about every breaker, which peers stop counting right away, and waits for the queued broadcasts
+// to be sent for up to half the time until the context's deadline. Then, it waits for the intent to leave to be sent for the remaining time.
+// Without a deadline, each step waits up to one second.
+func (c *Cluster) Leave(ctx context.Context) error {
+	if c.members == nil {
+		return NotStartedErr
+	}
+
+	c.mutex.Lock()
+	c.leaving = true
+	c.mutex.Unlock()
+
+	now := time.Now()
+	c.eachBreaker(func(name string, breaker *gedcb.Breaker) {
+		c.queueOpinion(name, breaker, breaker.State(now), now)
+	})
+
+	wait := time.Second
+	if _, ok := ctx.Deadline(); ok {
+		wait = timeout(ctx, 0) / 2
+	}
+
+	if queued := c.flush(ctx, wait); queued > 0 {
+		c.config.Logger.Printf("leaving with %d broadcasts still queued\n", queued)
+	}
+
+	return c.members.Leave(timeout(ctx, time.Second))
+}
+
+// flush waits for the queued broadcasts to be sent to peers, up to the given time, and returns how many are left.
+// Broadcasts are only sent while the local node has peers and gossips, so it does not wait otherwise.
+func (c *Cluster) flush(ctx context.Context, wait time.Duration) int {
+	if c.numMembers() <= 1 || c.config.Memberlist.GossipInterval <= 0 {
+		return 0
+	}
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(c.config.Memberlist.GossipInterval)
+	defer ticker.Stop()
+
+	for c.numQueued() > 0 && c.numMembers() > 1 {
+		select {
+		case <-ctx.Done():
+			return c.numQueued()
+		case <-deadline.C:
+			return c.numQueued()
+		case <-ticker.C:
+		}
+	}
+
+	return c.numQueued()
+}
+
+// numQueued returns the number of broadcasts waiting to be sent, or sent again, in both queues.
+func (c *Cluster) numQueued() int {
+	return c.queue.NumQueued() + c.priority.NumQueued()
+}
+
+// Shutdown stops gossiping and waits for background work to stop or the context to be done.
+// Shutdown does not leave the cluster, peers will detect the node as failed unless Leave is called first.
+func (c *Cluster) Shutdown(ctx context.Context) error {
+	if c.members == nil {
+		return NotStartedErr
+	}
+
+	c.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.done.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stopped:
+	}
+
+	return c.members.Shutdown()
+}
+
+// Members returns the alive members of the cluster, including the local node.
+func (c *Cluster) Members() []*memberlist.Node {
+	if c.members == nil {
+		return nil
+	}
+
+	return c.members.Members()
+}
+
+// LocalNode returns the local node's membership information, or nil if the cluster is not started.
+func (c *Cluster) LocalNode() *memberlist.Node {
+	if c.members == nil {
+		return nil
+	}
+
+	return c.members.LocalNode()
+}
+
+// numMembers returns the number of alive members, or one while the cluster is not started.
+func (c *Cluster) numMembers() int {
+	if c.members == nil {
+		return 1
+	}
+
+	return c.members.NumMembers()
+}
+
+// republish periodically re-broadcasts the counts of breakers in aggregate mode, and the failure keys of breakers tracking them,
+// so peers' cluster-wide view stays fresh.
+// It also broadcasts the opinions of breakers that became idle or active, or whose node's health changed, since their last broadcast,
+// which no state change would, and tells the breakers about the local node's health.
+func (c *Cluster) republish(ctx context.Context) {
+	defer c.done.Done()
+
+	ticker := time.NewTicker(c.config.CountsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			health := c.healthScore()
+			c.eachBreaker(func(name string, breaker *gedcb.Breaker) {
+				breaker.SetLocalHealth(health)
+
+				config := breaker.Config()
+				if config.ClusterAggregate || config.FailureKeys > 0 || c.activityChanged(name, breaker, now) || c.healthChanged(name, health) {
+					c.markDirty(name)
+				}
+			})
+		}
+	}
+}
+
+// timeout returns the time remaining until the context's deadline, or the fallback if it has none.
+func timeout(ctx context.Context, fallback time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+
+	return fallback
+}
@@ -0,0 +1,255 @@
+package gossip
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestConfig returns a configuration for a node gossiping on a random local port.
+func newTestConfig(name string) Config {
+	config := DefaultConfig()
+	config.Memberlist = memberlist.DefaultLocalConfig()
+	config.Memberlist.Name = name
+	config.Memberlist.BindAddr = "127.0.0.1"
+	config.Memberlist.BindPort = 0
+	config.Memberlist.LogOutput = io.Discard
+	// broadcasts are only retransmitted a few times and may all go to the same peer, so sync state often to bound the delay.
+	config.Memberlist.PushPullInterval = time.Second
+	config.Logger = log.New(io.Discard, "", 0)
+
+	return config
+}
+
+// startTestCluster starts a node for each config, joins them together and shuts them down at the end of the test.
+func startTestCluster(t *testing.T, configs ...Config) []*Cluster {
+	ctx := context.Background()
+	nodes := make([]*Cluster, 0, len(configs))
+
+	for _, config := range configs {
+		if len(nodes) > 0 {
+			config.Peers = []string{nodes[0].LocalNode().Address()}
+		}
+
+		node, err := NewCluster(config)
+		require.NoError(t, err)
+		require.NoError(t, node.Start(ctx))
+		require.NoError(t, node.Join(ctx))
+
+		t.Cleanup(func() {
+			_ = node.Shutdown(ctx)
+		})
+
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		eventually(t, func() bool {
+			return len(node.Members()) == len(nodes)
+		})
+	}
+
+	return nodes
+}
+
+// eventually fails the test if the condition does not become true within a few seconds.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// suspect records enough failures to move the breaker into Suspicion.
+func suspect(t *testing.T, breaker *gedcb.Breaker, config gedcb.BreakerConfig) {
+	now := time.Now()
+
+	for i := 0; i <= config.SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(now))
+	}
+
+	require.Equal(t, gedcb.Suspicion, breaker.State(now))
+}
+
+// peerSuspects returns true if the node knows that the given peer suspects a failure of the breaker.
+func peerSuspects(node *Cluster, peer, breaker string) bool {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	opinion, found := node.opinions[opinionKey{node: peer, breaker: breaker}]
+
+	return found && opinion.State != gedcb.Closed
+}
+
+func TestClusterMajoritySuspect(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"), newTestConfig("b"), newTestConfig("c"))
+	config := nodes[0].config.Breaker
+
+	suspect(t, nodes[0].Breaker("db"), config)
+	suspect(t, nodes[1].Breaker("db"), config)
+	suspect(t, nodes[2].Breaker("db"), config)
+
+	// the majority of c's peers suspect a failure, so it opens without reaching its hard failure threshold
+	eventually(t, func() bool {
+		return nodes[2].Breaker("db").State(time.Now()) == gedcb.Open
+	})
+}
+
+func TestClusterOpenQuorum(t *testing.T) {
+	configs := []Config{newTestConfig("a"), newTestConfig("b"), newTestConfig("c")}
+	for i := range configs {
+		configs[i].Breaker.OpenQuorum = 0.5
+		configs[i].Breaker.RemoteOpenDuration = time.Minute
+	}
+
+	nodes := startTestCluster(t, configs...)
+	for _, node := range nodes {
+		node.Breaker("db")
+	}
+
+	for _, node := range nodes[:2] {
+		db := node.Breaker("db")
+		for db.State(time.Now()) != gedcb.Open {
+			require.NoError(t, db.Failure(time.Now()))
+		}
+	}
+
+	// c has not seen a single failure, but both of its peers are open
+	eventually(t, func() bool {
+		return nodes[2].Breaker("db").State(time.Now()) == gedcb.RemoteOpen
+	})
+}
+
+func TestClusterNamedBreakers(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"), newTestConfig("b"), newTestConfig("c"))
+	config := nodes[0].config.Breaker
+
+	for _, node := range nodes {
+		node.Breaker("cache")
+	}
+
+	suspect(t, nodes[0].Breaker("db"), config)
+	suspect(t, nodes[1].Breaker("db"), config)
+	suspect(t, nodes[2].Breaker("db"), config)
+	suspect(t, nodes[2].Breaker("cache"), config)
+
+	eventually(t, func() bool {
+		return nodes[2].Breaker("db").State(time.Now()) == gedcb.Open
+	})
+
+	// peers' opinions about db do not count towards cache
+	require.Equal(t, gedcb.Suspicion, nodes[2].Breaker("cache").State(time.Now()))
+	require.Equal(t, []string{"cache", "db"}, nodes[2].Breakers())
+}
+
+func TestClusterLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+	require.Equal(t, NotStartedErr, node.Join(ctx))
+	require.Equal(t, NotStartedErr, node.Leave(ctx))
+	require.Nil(t, node.Members())
+
+	require.NoError(t, node.Start(ctx))
+	require.Equal(t, AlreadyStartedErr, node.Start(ctx))
+	require.NoError(t, node.Join(ctx))
+	require.Len(t, node.Members(), 1)
+
+	require.NoError(t, node.Leave(ctx))
+	require.NoError(t, node.Shutdown(ctx))
+}
+
+func TestNewClusterBreakers(t *testing.T) {
+	config := newTestConfig("a")
+	custom := config.Breaker
+	custom.SoftFailureThreshold = 0
+	config.Breakers = map[string]gedcb.BreakerConfig{"db": custom}
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+	require.Equal(t, []string{"db"}, node.Breakers())
+	require.Equal(t, 0, node.Breaker("db").Config().SoftFailureThreshold)
+	require.Equal(t, config.Breaker.SoftFailureThreshold, node.Breaker("cache").Config().SoftFailureThreshold)
+}
+
+func TestNewClusterInvalidDecay(t *testing.T) {
+	config := newTestConfig("a")
+	config.Decay = gedcb.ShiftedPolynomialDecaySpec(0)
+
+	_, err := NewCluster(config)
+	require.Error(t, err)
+}
+
+func TestClusterPushPull(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"), newTestConfig("b"))
+	breakerConfig := nodes[0].config.Breaker
+
+	suspect(t, nodes[0].Breaker("db"), breakerConfig)
+	suspect(t, nodes[1].Breaker("db"), breakerConfig)
+
+	// wait until the broadcasts are delivered and exhausted, so c can only learn the opinions from the state exchanged on join
+	eventually(t, func() bool {
+		return peerSuspects(nodes[0], "b", "db") && peerSuspects(nodes[1], "a", "db")
+	})
+	for _, node := range nodes {
+		eventually(t, func() bool {
+			return node.numQueued() == 0
+		})
+	}
+
+	config := newTestConfig("c")
+	config.Peers = []string{nodes[0].LocalNode().Address()}
+
+	c, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, c.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = c.Shutdown(context.Background())
+	})
+	require.NoError(t, c.Join(context.Background()))
+
+	eventually(t, func() bool {
+		return peerSuspects(c, "a", "db") && peerSuspects(c, "b", "db")
+	})
+
+	db := c.Breaker("db")
+	now := time.Now()
+	for i := 0; i <= breakerConfig.SoftFailureThreshold; i++ {
+		require.NoError(t, db.Failure(now))
+	}
+	require.Equal(t, gedcb.Open, db.State(now))
+}
+
+func TestClusterLeave(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"), newTestConfig("b"))
+	config := nodes[0].config.Breaker
+
+	suspect(t, nodes[0].Breaker("db"), config)
+	suspect(t, nodes[1].Breaker("db"), config)
+	eventually(t, func() bool {
+		return peerSuspects(nodes[0], "b", "db")
+	})
+
+	// b's leaving opinion is sent before its intent to leave
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, nodes[1].Leave(ctx))
+	require.Equal(t, 0, nodes[1].numQueued())
+
+	eventually(t, func() bool {
+		return len(nodes[0].Breaker("db").Peers()) == 0
+	})
+}
@@ -0,0 +1,564 @@
+package gossip
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// Every message starts with a header of the message type followed by the schema version of its body.
+const (
+	headerSize = 2
+
+	// SchemaVersion is the newest version of the message bodies this package reads and writes.
+	// Every message is written at the oldest version able to carry it, so nodes that have not upgraded yet keep reading
+	// the messages that do not use a newer state or flag.
+	SchemaVersion byte = 9
+	// MinSchemaVersion is the oldest version of the message bodies this package can read.
+	// Version 1 opinions did not name a breaker. Version 2 opinions did not carry an incarnation, which is read as zero.
+	MinSchemaVersion byte = 2
+
+	// incarnationSchemaVersion is the first version of opinions carrying an incarnation.
+	incarnationSchemaVersion byte = 3
+	// idleSchemaVersion is the first version of opinions with the isIdle flag.
+	idleSchemaVersion byte = 4
+	// healthSchemaVersion is the first version of opinions with the hasHealth flag.
+	healthSchemaVersion byte = 5
+	// leavingSchemaVersion is the first version of opinions with the isLeaving flag.
+	leavingSchemaVersion byte = 6
+	// remoteOpenSchemaVersion is the first version of opinions and metadata in the RemoteOpen state.
+	remoteOpenSchemaVersion byte = 7
+	// probeSchemaVersion is the first version of opinions with the isProbe flag.
+	probeSchemaVersion byte = 8
+	// failuresSchemaVersion is the first version of opinions with the hasFailures flag.
+	failuresSchemaVersion byte = 9
+
+	// batchSchemaVersion is the version batches and push/pull states are written at. Their layout has not changed
+	// since version 2, and each opinion in them carries its own version, so readers only skip the ones they cannot read.
+	batchSchemaVersion byte = 2
+)
+
+// Message types identify the body that follows the header.
+const (
+	opinionMessage byte = iota + 1
+	batchMessage
+	stateMessage
+	metaMessage
+)
+
+// batchHeaderSize is the largest header of a batch message with fewer than 2^16 entries.
+const batchHeaderSize = headerSize + binary.MaxVarintLen16
+
+// Flags of an opinion message.
+const (
+	hasCounts byte = 1 << iota
+	// hasSignature is only set on signed opinions, so nodes that do not sign stay readable by older versions.
+	hasSignature
+	// isIdle is only set by nodes tracking their breakers' activity, for the same reason. See idleSchemaVersion.
+	isIdle
+	// hasHealth is only set by unhealthy nodes, for the same reason. See healthSchemaVersion.
+	hasHealth
+	// isLeaving is only set by nodes leaving the cluster, for the same reason. See leavingSchemaVersion.
+	isLeaving
+	// isProbe is only set by probe results, for the same reason. See probeSchemaVersion.
+	isProbe
+	// hasFailures is only set by breakers tracking their failure keys, for the same reason. See failuresSchemaVersion.
+	hasFailures
+)
+
+// Bounds of the failure keys an opinion carries, so that it fits in a single UDP packet along with the rest of the opinion.
+const (
+	maxFailureKeys      = 8
+	maxFailureKeyLength = 64
+)
+
+// opinionFlags returns the flags opinions of the given version may set.
+func opinionFlags(version byte) byte {
+	flags := hasCounts | hasSignature
+	if version >= idleSchemaVersion {
+		flags |= isIdle
+	}
+
+	if version >= healthSchemaVersion {
+		flags |= hasHealth
+	}
+
+	if version >= leavingSchemaVersion {
+		flags |= isLeaving
+	}
+
+	if version >= probeSchemaVersion {
+		flags |= isProbe
+	}
+
+	if version >= failuresSchemaVersion {
+		flags |= hasFailures
+	}
+
+	return flags
+}
+
+// MalformedMessageErr is returned when a message is truncated, has trailing bytes or contains out of range values.
+var MalformedMessageErr = errors.New("malformed message")
+
+// UnknownMessageTypeErr is returned when a message's type byte is not recognized.
+var UnknownMessageTypeErr = errors.New("unknown message type")
+
+// UnsupportedVersionErr is returned when a message's schema version is outside MinSchemaVersion and SchemaVersion.
+var UnsupportedVersionErr = errors.New("unsupported schema version")
+
+// MarshalBinary encodes the broadcast as a compact opinion message.
+func (c CircuitBreakerBroadcast) MarshalBinary() ([]byte, error) {
+	if c.Version < 0 {
+		return nil, fmt.Errorf("%w: negative version %d", MalformedMessageErr, c.Version)
+	}
+
+	if c.Incarnation < 0 {
+		return nil, fmt.Errorf("%w: negative incarnation %d", MalformedMessageErr, c.Incarnation)
+	}
+
+	if c.State < gedcb.Closed || c.State > gedcb.RemoteOpen {
+		return nil, fmt.Errorf("%w: unknown state %d", MalformedMessageErr, c.State)
+	}
+
+	if c.Health < 0 {
+		return nil, fmt.Errorf("%w: negative health score %d", MalformedMessageErr, c.Health)
+	}
+
+	if len(c.Signature) > 0 && len(c.Signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: signature of %d bytes", MalformedMessageErr, len(c.Signature))
+	}
+
+	if c.Failures != nil {
+		if len(c.Failures.Keys) > maxFailureKeys {
+			return nil, fmt.Errorf("%w: %d failure keys exceed %d", MalformedMessageErr, len(c.Failures.Keys), maxFailureKeys)
+		}
+
+		for _, key := range c.Failures.Keys {
+			if len(key.Key) > maxFailureKeyLength || !validCount(key.Count) || !validCount(key.Error) {
+				return nil, fmt.Errorf("%w: failure key %q with count %v and error %v", MalformedMessageErr, key.Key, key.Count, key.Error)
+			}
+		}
+	}
+
+	buffer := make([]byte, 0, headerSize+binary.MaxVarintLen64*5+len(c.Node)+len(c.Breaker)+2+16+len(c.Signature))
+	buffer = append(buffer, opinionMessage, c.schemaVersion())
+	buffer = binary.AppendUvarint(buffer, uint64(len(c.Node)))
+	buffer = append(buffer, c.Node...)
+	buffer = binary.AppendUvarint(buffer, uint64(len(c.Breaker)))
+	buffer = append(buffer, c.Breaker...)
+	buffer = binary.AppendUvarint(buffer, uint64(c.Incarnation))
+	buffer = binary.AppendUvarint(buffer, uint64(c.Version))
+	buffer = append(buffer, byte(c.State))
+
+	flags := byte(0)
+	if c.Counts != nil {
+		flags |= hasCounts
+	}
+
+	if len(c.Signature) > 0 {
+		flags |= hasSignature
+	}
+
+	if c.Idle {
+		flags |= isIdle
+	}
+
+	if c.Health > 0 {
+		flags |= hasHealth
+	}
+
+	if c.Leaving {
+		flags |= isLeaving
+	}
+
+	if c.Probe {
+		flags |= isProbe
+	}
+
+	if c.Failures != nil {
+		flags |= hasFailures
+	}
+
+	buffer = append(buffer, flags)
+
+	if c.Counts != nil {
+		buffer = binary.AppendVarint(buffer, c.Counts.Timestamp.UnixNano())
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(c.Counts.Successes))
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(c.Counts.Failures))
+	}
+
+	if c.Health > 0 {
+		buffer = binary.AppendUvarint(buffer, uint64(c.Health))
+	}
+
+	if c.Failures != nil {
+		buffer = binary.AppendVarint(buffer, c.Failures.Timestamp.UnixNano())
+		buffer = binary.AppendUvarint(buffer, uint64(len(c.Failures.Keys)))
+		for _, key := range c.Failures.Keys {
+			buffer = binary.AppendUvarint(buffer, uint64(len(key.Key)))
+			buffer = append(buffer, key.Key...)
+			buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(key.Count))
+			buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(key.Error))
+		}
+	}
+
+	return append(buffer, c.Signature...), nil
+}
+
+// schemaVersion returns the oldest version able to carry the opinion.
+func (c CircuitBreakerBroadcast) schemaVersion() byte {
+	switch {
+	case c.Failures != nil:
+		return failuresSchemaVersion
+	case c.Probe:
+		return probeSchemaVersion
+	case c.State == gedcb.RemoteOpen:
+		return remoteOpenSchemaVersion
+	case c.Leaving:
+		return leavingSchemaVersion
+	case c.Health > 0:
+		return healthSchemaVersion
+	case c.Idle:
+		return idleSchemaVersion
+	default:
+		return incarnationSchemaVersion
+	}
+}
+
+// UnmarshalBinary decodes an opinion message. It rejects anything but a single well-formed message,
+// including a state or flag its version does not have.
+func (c *CircuitBreakerBroadcast) UnmarshalBinary(data []byte) error {
+	reader, err := newMessageReader(data, opinionMessage)
+	if err != nil {
+		return err
+	}
+
+	var decoded CircuitBreakerBroadcast
+
+	decoded.Node = reader.string()
+	decoded.Breaker = reader.string()
+	if reader.version >= incarnationSchemaVersion {
+		decoded.Incarnation = reader.int64()
+	}
+	decoded.Version = reader.int()
+	decoded.State = reader.state()
+
+	flagsOffset := len(data) - len(reader.data)
+	flags := reader.byte()
+	if flags&^opinionFlags(reader.version) != 0 {
+		reader.fail("unknown flags %#x", flags)
+	}
+
+	decoded.Idle = flags&isIdle != 0
+	decoded.Leaving = flags&isLeaving != 0
+	decoded.Probe = flags&isProbe != 0
+
+	if flags&hasCounts != 0 {
+		decoded.Counts = &gedcb.DecayedCounts{
+			Timestamp: time.Unix(0, reader.varint()),
+			Successes: reader.count(),
+			Failures:  reader.count(),
+		}
+	}
+
+	if flags&hasHealth != 0 {
+		decoded.Health = reader.int()
+	}
+
+	if flags&hasFailures != 0 {
+		decoded.Failures = &gedcb.DecayedFailures{Timestamp: time.Unix(0, reader.varint())}
+
+		count := reader.uvarint()
+		if count > maxFailureKeys {
+			reader.fail("%d failure keys exceed %d", count, maxFailureKeys)
+			count = 0
+		}
+
+		decoded.Failures.Keys = make([]gedcb.HeavyHitter, 0, count)
+		for i := uint64(0); i < count && reader.err == nil; i++ {
+			key := gedcb.HeavyHitter{Key: reader.string()}
+			if len(key.Key) > maxFailureKeyLength {
+				reader.fail("failure key of %d bytes exceeds %d", len(key.Key), maxFailureKeyLength)
+			}
+
+			key.Count, key.Error = reader.count(), reader.count()
+			decoded.Failures.Keys = append(decoded.Failures.Keys, key)
+		}
+	}
+
+	if flags&hasSignature != 0 {
+		decoded.Signature = reader.fixed(ed25519.SignatureSize)
+	}
+
+	if err = reader.close(); err != nil {
+		return err
+	}
+
+	if flags&hasSignature != 0 {
+		decoded.received = bytes.Clone(data)
+		// the node signed the opinion encoded without its signature, which only differs from the received bytes by the signature and its flag.
+		decoded.signed = bytes.Clone(data[:len(data)-ed25519.SignatureSize])
+		decoded.signed[flagsOffset] &^= hasSignature
+	}
+
+	*c = decoded
+
+	return nil
+}
+
+// encodeBatch packs already encoded opinions into a single batch message.
+func encodeBatch(messages [][]byte) []byte {
+	return encodeMessages(batchMessage, messages)
+}
+
+// encodeMessages packs already encoded opinions into a single message of the given type.
+// Batches and push/pull states share the same layout and only differ in how they are used.
+func encodeMessages(messageType byte, messages [][]byte) []byte {
+	size := batchHeaderSize
+	for _, message := range messages {
+		size += binary.MaxVarintLen16 + len(message)
+	}
+
+	buffer := make([]byte, 0, size)
+	buffer = append(buffer, messageType, batchSchemaVersion)
+	buffer = binary.AppendUvarint(buffer, uint64(len(messages)))
+
+	for _, message := range messages {
+		buffer = binary.AppendUvarint(buffer, uint64(len(message)))
+		buffer = append(buffer, message...)
+	}
+
+	return buffer
+}
+
+// DecodeMessage decodes an opinion, a batch of opinions or a push/pull state. It skips the opinions of a batch that
+// cannot be decoded, such as those written by a newer version, and returns the others along with an error for the
+// skipped ones. It rejects the whole message if the batch itself is malformed.
+func DecodeMessage(data []byte) ([]CircuitBreakerBroadcast, error) {
+	opinions, skipped, err := decodeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return opinions, errors.Join(skipped...)
+}
+
+// decodeMessage decodes a message like DecodeMessage, returning the errors of the skipped opinions separately.
+func decodeMessage(data []byte) ([]CircuitBreakerBroadcast, []error, error) {
+	messageType := byte(0)
+	if len(data) > 0 {
+		messageType = data[0]
+	}
+
+	switch messageType {
+	case opinionMessage:
+		var opinion CircuitBreakerBroadcast
+		if err := opinion.UnmarshalBinary(data); err != nil {
+			return nil, nil, err
+		}
+
+		return []CircuitBreakerBroadcast{opinion}, nil, nil
+	case stateMessage:
+	default:
+		messageType = batchMessage
+	}
+
+	reader, err := newMessageReader(data, messageType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count := reader.uvarint()
+	// every entry takes at least a length byte, which bounds the allocation by the message size.
+	if count > uint64(len(reader.data)) {
+		return nil, nil, fmt.Errorf("%w: %d entries exceed remaining %d bytes", MalformedMessageErr, count, len(reader.data))
+	}
+
+	var skipped []error
+	opinions := make([]CircuitBreakerBroadcast, 0, count)
+	for i := uint64(0); i < count && reader.err == nil; i++ {
+		entry := reader.bytes()
+		if reader.err != nil {
+			break
+		}
+
+		var opinion CircuitBreakerBroadcast
+		if err = opinion.UnmarshalBinary(entry); err != nil {
+			skipped = append(skipped, fmt.Errorf("opinion %d: %w", i, err))
+			continue
+		}
+
+		opinions = append(opinions, opinion)
+	}
+
+	if err = reader.close(); err != nil {
+		return nil, nil, err
+	}
+
+	return opinions, skipped, nil
+}
+
+// messageReader decodes the fields of a message body, remembering the first error so callers can check it once at the end.
+type messageReader struct {
+	data    []byte
+	version byte
+	err     error
+}
+
+// newMessageReader validates the message header and returns a reader positioned at the start of the body.
+func newMessageReader(data []byte, messageType byte) (*messageReader, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: missing header", MalformedMessageErr)
+	}
+
+	if data[0] != messageType {
+		return nil, fmt.Errorf("%w: %d", UnknownMessageTypeErr, data[0])
+	}
+
+	if data[1] < MinSchemaVersion || data[1] > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d", UnsupportedVersionErr, data[1])
+	}
+
+	return &messageReader{data: data[headerSize:], version: data[1]}, nil
+}
+
+func (r *messageReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", MalformedMessageErr, fmt.Sprintf(format, args...))
+	}
+
+	r.data = nil
+}
+
+func (r *messageReader) byte() byte {
+	if len(r.data) < 1 {
+		r.fail("truncated")
+		return 0
+	}
+
+	value := r.data[0]
+	r.data = r.data[1:]
+
+	return value
+}
+
+func (r *messageReader) uvarint() uint64 {
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("invalid unsigned varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *messageReader) varint() int64 {
+	value, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail("invalid varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *messageReader) int() int {
+	value := r.uvarint()
+	if value > math.MaxInt {
+		r.fail("integer %d overflows", value)
+		return 0
+	}
+
+	return int(value)
+}
+
+func (r *messageReader) int64() int64 {
+	value := r.uvarint()
+	if value > math.MaxInt64 {
+		r.fail("integer %d overflows", value)
+		return 0
+	}
+
+	return int64(value)
+}
+
+func (r *messageReader) bytes() []byte {
+	length := r.uvarint()
+	if length > uint64(len(r.data)) {
+		r.fail("length %d exceeds remaining %d bytes", length, len(r.data))
+		return nil
+	}
+
+	value := r.data[:length]
+	r.data = r.data[length:]
+
+	return value
+}
+
+// fixed reads a field of the given size, copied so it does not keep the message alive.
+func (r *messageReader) fixed(size int) []byte {
+	if len(r.data) < size {
+		r.fail("truncated")
+		return nil
+	}
+
+	value := append([]byte(nil), r.data[:size]...)
+	r.data = r.data[size:]
+
+	return value
+}
+
+func (r *messageReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *messageReader) state() gedcb.State {
+	state := gedcb.State(r.byte())
+	if state > gedcb.RemoteOpen || state == gedcb.RemoteOpen && r.version < remoteOpenSchemaVersion {
+		r.fail("unknown state %d in version %d", state, r.version)
+	}
+
+	return state
+}
+
+// count reads a decayed count, which must be a finite non-negative number.
+func (r *messageReader) count() float64 {
+	if len(r.data) < 8 {
+		r.fail("truncated")
+		return 0
+	}
+
+	value := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+
+	if !validCount(value) {
+		r.fail("invalid count %v", value)
+	}
+
+	return value
+}
+
+// validCount returns true if the value is a finite non-negative number.
+func validCount(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0) && value >= 0
+}
+
+// close returns the first decoding error, or an error if there are unread bytes.
+func (r *messageReader) close() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d trailing bytes", len(r.data))
+	}
+
+	return r.err
+}
@@ -0,0 +1,312 @@
+package gossip
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+// udpBudget is the space left for a user message in memberlist's default UDP buffer after the compound and user message headers.
+const udpBudget = 1400 - 16
+
+func newTestBroadcast() CircuitBreakerBroadcast {
+	return CircuitBreakerBroadcast{
+		Node:        "example-0.example.default.svc.cluster.local",
+		Breaker:     "payments-api.default.svc.cluster.local:8080",
+		Incarnation: 1_700_000_000_000_000_000,
+		Version:     42,
+		State:       gedcb.Suspicion,
+		Counts: &gedcb.DecayedCounts{
+			Timestamp: time.Unix(0, 1_700_000_000_123_456_789),
+			Successes: 96.5,
+			Failures:  3.25,
+		},
+	}
+}
+
+func TestCircuitBreakerBroadcastBinary(t *testing.T) {
+	for _, expected := range []CircuitBreakerBroadcast{newTestBroadcast(), {Node: "a", State: gedcb.Open}, {Node: "a", State: gedcb.Suspicion, Health: 3}, {Node: "a", Leaving: true}, {Node: "a", State: gedcb.RemoteOpen}, {Node: "a", State: gedcb.Closed, Probe: true}, {Node: "a", Failures: &gedcb.DecayedFailures{Timestamp: time.Unix(0, 42), Keys: []gedcb.HeavyHitter{{Key: "GET /users", Count: 2.5, Error: 0.5}}}}} {
+		data, err := expected.MarshalBinary()
+		require.NoError(t, err)
+
+		var actual CircuitBreakerBroadcast
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestCircuitBreakerBroadcastMarshalErrors(t *testing.T) {
+	_, err := CircuitBreakerBroadcast{Node: "a", Version: -1}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = CircuitBreakerBroadcast{Node: "a", Incarnation: -1}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = CircuitBreakerBroadcast{Node: "a", State: gedcb.State(42)}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = CircuitBreakerBroadcast{Node: "a", Health: -1}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = CircuitBreakerBroadcast{Node: "a", Failures: &gedcb.DecayedFailures{Keys: make([]gedcb.HeavyHitter, maxFailureKeys+1)}}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = CircuitBreakerBroadcast{Node: "a", Failures: &gedcb.DecayedFailures{Keys: []gedcb.HeavyHitter{{Key: strings.Repeat("k", maxFailureKeyLength+1)}}}}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+}
+
+func TestCircuitBreakerBroadcastUnmarshalWithoutIncarnation(t *testing.T) {
+	var decoded CircuitBreakerBroadcast
+	require.NoError(t, decoded.UnmarshalBinary([]byte{opinionMessage, 2, 1, 'a', 1, 'b', 7, byte(gedcb.Open), 0}))
+	require.Equal(t, CircuitBreakerBroadcast{Node: "a", Breaker: "b", Version: 7, State: gedcb.Open}, decoded)
+}
+
+func TestCircuitBreakerBroadcastUnmarshalErrors(t *testing.T) {
+	valid, err := newTestBroadcast().MarshalBinary()
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		data     []byte
+		expected error
+	}{
+		"empty":         {nil, MalformedMessageErr},
+		"header only":   {valid[:headerSize], MalformedMessageErr},
+		"truncated":     {valid[:len(valid)-1], MalformedMessageErr},
+		"trailing":      {append(append([]byte{}, valid...), 0), MalformedMessageErr},
+		"unknown type":  {append([]byte{0xff}, valid[1:]...), UnknownMessageTypeErr},
+		"future schema": {append([]byte{opinionMessage, SchemaVersion + 1}, valid[2:]...), UnsupportedVersionErr},
+		"old schema":    {append([]byte{opinionMessage, MinSchemaVersion - 1}, valid[2:]...), UnsupportedVersionErr},
+		"json":          {[]byte(`{"Node":"a","Version":1,"State":0}`), UnknownMessageTypeErr},
+		"unknown state": {[]byte{opinionMessage, SchemaVersion, 1, 'a', 1, 'b', 1, 1, 9, 0}, MalformedMessageErr},
+		"unknown flags": {[]byte{opinionMessage, SchemaVersion, 1, 'a', 1, 'b', 1, 1, 0, 64}, MalformedMessageErr},
+		"long name":     {[]byte{opinionMessage, SchemaVersion, 9, 'a', 1, 'b', 1, 1, 0, 0}, MalformedMessageErr},
+		"incarnation overflow": {
+			[]byte{opinionMessage, SchemaVersion, 1, 'a', 1, 'b', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 1, 0, 0},
+			MalformedMessageErr,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			decoded := newTestBroadcast()
+			err := decoded.UnmarshalBinary(c.data)
+			require.True(t, errors.Is(err, c.expected), "expected %v, got %v", c.expected, err)
+			require.Equal(t, newTestBroadcast(), decoded, "failed decoding must not modify the destination")
+		})
+	}
+}
+
+func TestCircuitBreakerBroadcastSize(t *testing.T) {
+	broadcast := newTestBroadcast()
+	broadcast.Node = strings.Repeat("n", 253)
+	broadcast.Breaker = strings.Repeat("b", 253)
+	broadcast.Health = math.MaxInt
+	broadcast.Signature = make([]byte, 64)
+	broadcast.Failures = &gedcb.DecayedFailures{Timestamp: broadcast.Counts.Timestamp}
+	for i := 0; i < maxFailureKeys; i++ {
+		broadcast.Failures.Keys = append(broadcast.Failures.Keys, gedcb.HeavyHitter{Key: strings.Repeat("k", maxFailureKeyLength), Count: 1, Error: 1})
+	}
+
+	binary, err := broadcast.MarshalBinary()
+	require.NoError(t, err)
+
+	text, err := json.Marshal(broadcast)
+	require.NoError(t, err)
+
+	require.True(t, len(binary) < udpBudget, "%d bytes exceeds the UDP budget", len(binary))
+	require.True(t, len(binary) < len(text), "binary %d bytes, JSON %d bytes", len(binary), len(text))
+}
+
+func TestDecodeMessage(t *testing.T) {
+	first, err := newTestBroadcast().MarshalBinary()
+	require.NoError(t, err)
+
+	second, err := CircuitBreakerBroadcast{Node: "a", Breaker: "b", Version: 1}.MarshalBinary()
+	require.NoError(t, err)
+
+	opinions, err := DecodeMessage(first)
+	require.NoError(t, err)
+	require.Equal(t, []CircuitBreakerBroadcast{newTestBroadcast()}, opinions)
+
+	opinions, err = DecodeMessage(encodeBatch([][]byte{first, second}))
+	require.NoError(t, err)
+	require.Equal(t, []CircuitBreakerBroadcast{newTestBroadcast(), {Node: "a", Breaker: "b", Version: 1}}, opinions)
+
+	cases := map[string]struct {
+		data     []byte
+		expected error
+	}{
+		"empty":           {nil, MalformedMessageErr},
+		"truncated batch": {encodeBatch([][]byte{first, second})[:20], MalformedMessageErr},
+		"missing entries": {[]byte{batchMessage, SchemaVersion, 2, 0}, MalformedMessageErr},
+		"nested batch":    {encodeBatch([][]byte{encodeBatch([][]byte{first})}), UnknownMessageTypeErr},
+		"trailing":        {append(encodeBatch([][]byte{first}), 0), MalformedMessageErr},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			opinions, err := DecodeMessage(c.data)
+			require.True(t, errors.Is(err, c.expected), "expected %v, got %v", c.expected, err)
+			require.Empty(t, opinions)
+		})
+	}
+
+	// a malformed opinion only drops itself, not the rest of the batch
+	future := append([]byte{opinionMessage, SchemaVersion + 1}, second[headerSize:]...)
+	opinions, err = DecodeMessage(encodeBatch([][]byte{second[:len(second)-1], first, future}))
+	require.True(t, errors.Is(err, MalformedMessageErr), "expected %v, got %v", MalformedMessageErr, err)
+	require.True(t, errors.Is(err, UnsupportedVersionErr), "expected %v, got %v", UnsupportedVersionErr, err)
+	require.Equal(t, []CircuitBreakerBroadcast{newTestBroadcast()}, opinions)
+}
+
+func TestSchemaVersions(t *testing.T) {
+	cases := map[string]struct {
+		opinion CircuitBreakerBroadcast
+		version byte
+	}{
+		"plain":       {newTestBroadcast(), incarnationSchemaVersion},
+		"signed":      {CircuitBreakerBroadcast{Node: "a", Signature: make([]byte, 64)}, incarnationSchemaVersion},
+		"idle":        {CircuitBreakerBroadcast{Node: "a", Idle: true}, idleSchemaVersion},
+		"health":      {CircuitBreakerBroadcast{Node: "a", Health: 2}, healthSchemaVersion},
+		"leaving":     {CircuitBreakerBroadcast{Node: "a", Leaving: true}, leavingSchemaVersion},
+		"remote open": {CircuitBreakerBroadcast{Node: "a", State: gedcb.RemoteOpen}, remoteOpenSchemaVersion},
+		"probe":       {CircuitBreakerBroadcast{Node: "a", Probe: true}, probeSchemaVersion},
+		"failures":    {CircuitBreakerBroadcast{Node: "a", Failures: &gedcb.DecayedFailures{Timestamp: time.Unix(0, 1), Keys: []gedcb.HeavyHitter{}}}, failuresSchemaVersion},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// opinions are written at the oldest version carrying them, so older nodes keep reading the rest
+			data, err := c.opinion.MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, c.version, data[1])
+
+			var decoded CircuitBreakerBroadcast
+			require.NoError(t, decoded.UnmarshalBinary(data))
+			decoded.received, decoded.signed = nil, nil
+			require.Equal(t, c.opinion, decoded)
+
+			// an older version does not have the opinion's state or flag
+			if c.version > incarnationSchemaVersion {
+				data[1] = c.version - 1
+				require.True(t, errors.Is(decoded.UnmarshalBinary(data), MalformedMessageErr))
+			}
+		})
+	}
+
+	// batches stay readable by every supported version, which then only skip the opinions they cannot read
+	batch := encodeBatch(nil)
+	require.Equal(t, MinSchemaVersion, batch[1])
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	first, err := newTestBroadcast().MarshalBinary()
+	require.NoError(f, err)
+
+	f.Add(first)
+	f.Add(encodeBatch([][]byte{first, first}))
+	f.Add([]byte{batchMessage, SchemaVersion, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opinions, _, err := decodeMessage(data)
+		if err != nil {
+			return
+		}
+
+		messages := make([][]byte, 0, len(opinions))
+		for _, opinion := range opinions {
+			message, err := opinion.MarshalBinary()
+			require.NoError(t, err)
+			messages = append(messages, message)
+		}
+
+		roundTrip, err := DecodeMessage(encodeBatch(messages))
+		require.NoError(t, err)
+		require.Equal(t, opinions, roundTrip)
+	})
+}
+
+func FuzzCircuitBreakerBroadcastUnmarshalBinary(f *testing.F) {
+	for _, broadcast := range []CircuitBreakerBroadcast{newTestBroadcast(), {Node: "a"}} {
+		data, err := broadcast.MarshalBinary()
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte{opinionMessage, SchemaVersion})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var decoded CircuitBreakerBroadcast
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		encoded, err := decoded.MarshalBinary()
+		require.NoError(t, err)
+
+		var roundTrip CircuitBreakerBroadcast
+		require.NoError(t, roundTrip.UnmarshalBinary(encoded))
+		require.Equal(t, decoded, roundTrip)
+	})
+}
+
+func BenchmarkMarshalBinary(b *testing.B) {
+	broadcast := newTestBroadcast()
+
+	for i := 0; i < b.N; i++ {
+		data, err := broadcast.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	broadcast := newTestBroadcast()
+
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(broadcast)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	data, err := newTestBroadcast().MarshalBinary()
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportMetric(float64(udpBudget/len(data)), "msgs/packet")
+
+	for i := 0; i < b.N; i++ {
+		var broadcast CircuitBreakerBroadcast
+		if err := broadcast.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+	data, err := json.Marshal(newTestBroadcast())
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportMetric(float64(udpBudget/len(data)), "msgs/packet")
+
+	for i := 0; i < b.N; i++ {
+		var broadcast CircuitBreakerBroadcast
+		if err := json.Unmarshal(data, &broadcast); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package gossip
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// DampingConfig limits how often the local node broadcasts the state of a flapping breaker, like BGP's route flap damping.
+// Every state change of a breaker adds to its penalty, which halves every HalfLife. Once the penalty reaches the SuppressThreshold,
+// the breaker's state changes are not broadcast until the penalty decays below the ReuseThreshold. Peers keep the last state they heard.
+// Open states are always broadcast immediately, so damping never delays tripping the cluster's breakers.
+type DampingConfig struct {
+	// Penalty is added to a breaker's penalty on every state change. Zero disables suppression.
+	Penalty float64
+	// SuppressThreshold is the penalty from which a breaker's state changes are suppressed.
+	SuppressThreshold float64
+	// ReuseThreshold is the penalty below which a suppressed breaker's state changes are broadcast again.
+	ReuseThreshold float64
+	// HalfLife is how long the penalty takes to decay by half.
+	HalfLife time.Duration
+	// MaxSuppressTime bounds how long a breaker stays suppressed after its last state change, by capping its penalty.
+	// It should be shorter than the OpinionTTL, since suppressed breakers do not send heartbeats. Zero leaves the penalty uncapped.
+	MaxSuppressTime time.Duration
+	// MinHoldTime is the minimum time a broadcast state stays advertised before a change other than to Open is broadcast.
+	MinHoldTime time.Duration
+}
+
+// DefaultDampingConfig returns BGP's default damping thresholds, with a half-life suited to breakers rather than routes.
+func DefaultDampingConfig() DampingConfig {
+	return DampingConfig{
+		Penalty:           1000,
+		SuppressThreshold: 2000,
+		ReuseThreshold:    750,
+		HalfLife:          15 * time.Second,
+		MaxSuppressTime:   time.Minute,
+		MinHoldTime:       time.Second,
+	}
+}
+
+// validate returns an error if suppression is enabled with thresholds that would never suppress a breaker or never reuse it.
+func (c DampingConfig) validate() error {
+	if c.Penalty <= 0 {
+		return nil
+	}
+
+	if c.HalfLife <= 0 {
+		return fmt.Errorf("damping half-life of %v", c.HalfLife)
+	}
+
+	if c.ReuseThreshold <= 0 || c.ReuseThreshold >= c.SuppressThreshold {
+		return fmt.Errorf("damping reuse threshold %v is not between zero and the suppress threshold %v", c.ReuseThreshold, c.SuppressThreshold)
+	}
+
+	return nil
+}
+
+// maxPenalty returns the penalty that decays to the ReuseThreshold within the MaxSuppressTime.
+func (c DampingConfig) maxPenalty() float64 {
+	if c.MaxSuppressTime <= 0 {
+		return math.Inf(1)
+	}
+
+	return c.ReuseThreshold * math.Exp2(float64(c.MaxSuppressTime)/float64(c.HalfLife))
+}
+
+// damper tracks a breaker's flaps and the state last broadcast for it. It is guarded by the cluster's dirtyMutex.
+type damper struct {
+	penalty      float64
+	updated      time.Time
+	suppressed   bool
+	advertised   gedcb.State
+	advertisedAt time.Time
+	started      bool
+	pending      bool
+}
+
+// decay reduces the penalty for the time elapsed since it was last updated, ending the suppression below the ReuseThreshold.
+func (d *damper) decay(config DampingConfig, now time.Time) {
+	if config.Penalty <= 0 {
+		return
+	}
+
+	if elapsed := now.Sub(d.updated); elapsed > 0 {
+		d.penalty *= math.Exp2(-float64(elapsed) / float64(config.HalfLife))
+		d.updated = now
+	}
+
+	if d.suppressed && d.penalty < config.ReuseThreshold {
+		d.suppressed = false
+	}
+}
+
+// holding returns true while state changes other than to Open must not be broadcast.
+func (d *damper) holding(config DampingConfig, now time.Time) bool {
+	return d.suppressed || (d.started && now.Sub(d.advertisedAt) < config.MinHoldTime)
+}
+
+// flap penalizes a state change, returning true if the change will not be broadcast immediately.
+func (d *damper) flap(config DampingConfig, state gedcb.State, now time.Time) bool {
+	d.decay(config, now)
+
+	if config.Penalty > 0 {
+		d.penalty = min(d.penalty+config.Penalty, config.maxPenalty())
+		d.suppressed = d.suppressed || d.penalty >= config.SuppressThreshold
+	}
+
+	return state != gedcb.Open && d.holding(config, now)
+}
+
+// advertise returns true if the breaker's state should be broadcast now, and records it as advertised.
+// A deferred change is dropped if the breaker returns to the advertised state before it can be broadcast.
+func (d *damper) advertise(config DampingConfig, state gedcb.State, now time.Time) bool {
+	d.decay(config, now)
+
+	changed := !d.started || state != d.advertised
+	if changed && state != gedcb.Open && d.holding(config, now) {
+		d.pending = true
+		return false
+	}
+
+	if !changed && d.pending {
+		d.pending = false
+		return false
+	}
+
+	if changed {
+		d.advertised = state
+		d.advertisedAt = now
+	}
+
+	d.started = true
+	d.pending = false
+
+	return true
+}
+
+// damperOf returns the damper of the named breaker. The caller must hold the dirtyMutex.
+func (c *Cluster) damperOf(name string) *damper {
+	d, found := c.dampers[name]
+	if !found {
+		d = &damper{}
+		c.dampers[name] = d
+	}
+
+	return d
+}
+
+// flapped marks the named breaker dirty after a state change and penalizes the change.
+// It is called from the breaker's OnStateChange while the breaker is locked, see markDirty.
+func (c *Cluster) flapped(name string, state gedcb.State) {
+	now := time.Now()
+
+	c.dirtyMutex.Lock()
+	defer c.dirtyMutex.Unlock()
+
+	c.dirty[name] = true
+	if c.damperOf(name).flap(c.config.Damping, state, now) {
+		c.stats.suppressedFlaps.Add(1)
+	}
+}
+
+// advertise returns true if the local node's opinion about the named breaker in the given state should be broadcast now.
+// Otherwise, the breaker stays dirty so the state is broadcast once damping allows it.
+func (c *Cluster) advertise(name string, state gedcb.State, now time.Time) bool {
+	c.dirtyMutex.Lock()
+	defer c.dirtyMutex.Unlock()
+
+	d := c.damperOf(name)
+	if d.advertise(c.config.Damping, state, now) {
+		return true
+	}
+
+	if d.pending {
+		c.dirty[name] = true
+	}
+
+	return false
+}
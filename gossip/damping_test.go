@@ -0,0 +1,106 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDamper(t *testing.T) {
+	config := DefaultDampingConfig()
+	now := time.Now()
+	d := &damper{}
+
+	require.True(t, d.advertise(config, gedcb.Closed, now))
+
+	// a change within the hold time waits, and is dropped if the breaker returns to the advertised state
+	require.True(t, d.flap(config, gedcb.Suspicion, now))
+	require.False(t, d.advertise(config, gedcb.Suspicion, now))
+	require.True(t, d.flap(config, gedcb.Closed, now))
+	require.False(t, d.advertise(config, gedcb.Closed, now.Add(config.MinHoldTime)))
+
+	// the second flap reached the suppress threshold, so changes wait for the penalty to decay below the reuse threshold
+	now = now.Add(config.MinHoldTime)
+	require.True(t, d.flap(config, gedcb.Suspicion, now))
+	require.False(t, d.advertise(config, gedcb.Suspicion, now.Add(config.HalfLife)))
+
+	// except for Open
+	require.False(t, d.flap(config, gedcb.Open, now))
+	require.True(t, d.advertise(config, gedcb.Open, now))
+
+	// once the penalty decays, changes are broadcast again
+	now = now.Add(3 * config.HalfLife)
+	require.False(t, d.flap(config, gedcb.HalfOpen, now))
+	require.True(t, d.advertise(config, gedcb.HalfOpen, now))
+}
+
+func TestDamperMaxSuppressTime(t *testing.T) {
+	config := DefaultDampingConfig()
+	now := time.Now()
+	d := &damper{}
+
+	require.True(t, d.advertise(config, gedcb.Closed, now))
+	for i := 0; i < 100; i++ {
+		d.flap(config, gedcb.Suspicion, now)
+	}
+
+	require.False(t, d.advertise(config, gedcb.Suspicion, now.Add(config.MaxSuppressTime-time.Second)))
+	require.True(t, d.advertise(config, gedcb.Suspicion, now.Add(config.MaxSuppressTime+time.Second)))
+}
+
+func TestDampingConfigValidate(t *testing.T) {
+	require.NoError(t, DampingConfig{}.validate())
+	require.NoError(t, DampingConfig{MinHoldTime: time.Second}.validate())
+	require.NoError(t, DefaultDampingConfig().validate())
+
+	config := DefaultDampingConfig()
+	config.HalfLife = 0
+	require.Error(t, config.validate())
+
+	config = DefaultDampingConfig()
+	config.ReuseThreshold = config.SuppressThreshold
+	require.Error(t, config.validate())
+}
+
+func TestDelegateGetBroadcastsDamping(t *testing.T) {
+	config := newTestConfig("a")
+	config.Damping.MinHoldTime = time.Minute
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	d := &delegate{cluster: node}
+	breaker := node.Breaker("db")
+	require.Equal(t, []gedcb.State{gedcb.Closed}, broadcastStates(t, d))
+
+	// Suspicion is held back, but Open is sent immediately
+	require.Equal(t, gedcb.Suspicion, suspectState(t, breaker))
+	require.Empty(t, broadcastStates(t, d))
+	require.Equal(t, uint64(1), node.Stats().SuppressedFlaps)
+
+	for breaker.State(time.Now()) != gedcb.Open {
+		require.NoError(t, breaker.Failure(time.Now()))
+	}
+	require.Equal(t, []gedcb.State{gedcb.Open}, broadcastStates(t, d))
+	require.Equal(t, uint64(1), node.Stats().SuppressedFlaps)
+}
+
+// broadcastStates returns the states of the local node's new opinions broadcast by the delegate, ignoring retransmissions.
+func broadcastStates(t *testing.T, d *delegate) []gedcb.State {
+	defer d.cluster.queue.Reset()
+	defer d.cluster.priority.Reset()
+
+	var states []gedcb.State
+	for _, message := range d.GetBroadcasts(0, 1400) {
+		opinions, err := DecodeMessage(message)
+		require.NoError(t, err)
+
+		for _, opinion := range opinions {
+			states = append(states, opinion.State)
+		}
+	}
+
+	return states
+}
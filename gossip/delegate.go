@@ -0,0 +1,86 @@
+package gossip
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// delegate receives memberlist's callbacks on behalf of a cluster, keeping them out of the cluster's public API.
+type delegate struct {
+	cluster *Cluster
+}
+
+func (d *delegate) NotifyJoin(node *memberlist.Node) {
+	d.cluster.memberJoined(node)
+	d.cluster.applyMeta(node)
+}
+
+func (d *delegate) NotifyLeave(node *memberlist.Node) {
+	d.cluster.memberLeft(node)
+	d.cluster.forgetNode(node.Name)
+}
+
+func (d *delegate) NotifyUpdate(node *memberlist.Node) {
+	d.cluster.applyMeta(node)
+}
+
+// NotifyAlive rejects nodes whose metadata is malformed or whose versions are incompatible, so they never become peers.
+func (d *delegate) NotifyAlive(node *memberlist.Node) error {
+	return d.cluster.checkMeta(node)
+}
+
+func (d *delegate) NodeMeta(limit int) []byte {
+	return d.cluster.localMeta(limit)
+}
+
+func (d *delegate) NotifyMsg(msg []byte) {
+	c := d.cluster
+
+	for _, opinion := range c.decode(msg, "broadcast") {
+		c.applyOpinion(opinion, "broadcast")
+	}
+}
+
+func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
+	c := d.cluster
+	now := time.Now()
+
+	for _, name := range c.takeDirty() {
+		breaker, found := c.lookupBreaker(name)
+		if !found {
+			continue
+		}
+
+		state := breaker.State(now)
+		if !c.advertise(name, state, now) {
+			continue
+		}
+
+		c.queueOpinion(name, breaker, state, now)
+	}
+
+	// reserve room for the batch header and a length prefix per message, so the batch fits within the limit.
+	// Open opinions go first, and other broadcasts fill the remaining room.
+	room := limit - overhead - batchHeaderSize
+	messages := c.priority.GetBroadcasts(binary.MaxVarintLen16, room)
+	for _, message := range messages {
+		room -= binary.MaxVarintLen16 + len(message)
+	}
+
+	messages = append(messages, c.queue.GetBroadcasts(binary.MaxVarintLen16, room)...)
+	if len(messages) <= 1 {
+		return messages
+	}
+
+	return [][]byte{encodeBatch(messages)}
+}
+
+func (d *delegate) LocalState(bool) []byte {
+	return d.cluster.localState()
+}
+
+func (d *delegate) MergeRemoteState(buf []byte, _ bool) {
+	d.cluster.mergeRemoteState(buf)
+}
@@ -0,0 +1,160 @@
+package gossip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegateGetBroadcastsBatches(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		node.Breaker(fmt.Sprintf("breaker-%02d", i))
+	}
+
+	d := &delegate{cluster: node}
+	overhead, limit := 3, 200
+	received := make(map[string]CircuitBreakerBroadcast)
+
+	for {
+		messages := d.GetBroadcasts(overhead, limit)
+		if len(messages) == 0 {
+			break
+		}
+
+		require.Len(t, messages, 1)
+		require.True(t, len(messages[0])+overhead <= limit, "%d bytes exceeds the limit", len(messages[0]))
+
+		opinions, err := DecodeMessage(messages[0])
+		require.NoError(t, err)
+
+		for _, opinion := range opinions {
+			require.Equal(t, "a", opinion.Node)
+			require.Equal(t, gedcb.Closed, opinion.State)
+			received[opinion.Breaker] = opinion
+		}
+	}
+
+	require.Len(t, received, 20)
+}
+
+func TestDelegateGetBroadcastsOpenFirst(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		node.Breaker(fmt.Sprintf("breaker-%02d", i))
+	}
+
+	// api is queued before the other breakers, which memberlist would send first as they are newer
+	api := node.Breaker("api")
+	for api.State(time.Now()) != gedcb.Open {
+		require.NoError(t, api.Failure(time.Now()))
+	}
+
+	// the room for a couple of opinions goes to the open breaker
+	messages := (&delegate{cluster: node}).GetBroadcasts(0, 80)
+	require.Len(t, messages, 1)
+
+	opinions, err := DecodeMessage(messages[0])
+	require.NoError(t, err)
+	require.Equal(t, "api", opinions[0].Breaker)
+	require.Equal(t, gedcb.Open, opinions[0].State)
+}
+
+func TestDelegateNotifyMsg(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	d := &delegate{cluster: node}
+	db := node.Breaker("db")
+
+	message, err := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Version: 1, State: gedcb.Open}.MarshalBinary()
+	require.NoError(t, err)
+	d.NotifyMsg(message)
+
+	// opinions about breakers the node does not have are ignored
+	message, err = CircuitBreakerBroadcast{Node: "b", Breaker: "cache", Version: 1, State: gedcb.Open}.MarshalBinary()
+	require.NoError(t, err)
+	d.NotifyMsg(message)
+
+	d.NotifyMsg([]byte("garbage"))
+
+	require.Equal(t, uint64(1), node.Stats().DroppedMessages)
+	require.Equal(t, []string{"db"}, node.Breakers())
+
+	// b's opinion is the majority, so the breaker opens as soon as it suspects a failure
+	now := time.Now()
+	for i := 0; i <= node.config.Breaker.SoftFailureThreshold; i++ {
+		require.NoError(t, db.Failure(now))
+	}
+	require.Equal(t, gedcb.Open, db.State(now))
+}
+
+func TestBroadcastInvalidates(t *testing.T) {
+	older, err := newBroadcast(CircuitBreakerBroadcast{Node: "a", Breaker: "db", Version: 1})
+	require.NoError(t, err)
+
+	newer, err := newBroadcast(CircuitBreakerBroadcast{Node: "a", Breaker: "db", Version: 2})
+	require.NoError(t, err)
+
+	other, err := newBroadcast(CircuitBreakerBroadcast{Node: "a", Breaker: "cache", Version: 3})
+	require.NoError(t, err)
+
+	restarted, err := newBroadcast(CircuitBreakerBroadcast{Node: "a", Breaker: "db", Incarnation: 1, Version: 1})
+	require.NoError(t, err)
+
+	require.True(t, newer.Invalidates(older))
+	require.False(t, older.Invalidates(newer))
+	require.False(t, other.Invalidates(older))
+	require.True(t, restarted.Invalidates(newer))
+	require.False(t, newer.Invalidates(restarted))
+}
+
+func TestDelegateMergeRemoteState(t *testing.T) {
+	a, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+	suspect(t, a.Breaker("db"), a.config.Breaker)
+
+	// a's broadcast is lost, so b only learns about it through a push/pull exchange
+	require.NotEmpty(t, (&delegate{cluster: a}).GetBroadcasts(0, 1024))
+
+	b, err := NewCluster(newTestConfig("b"))
+	require.NoError(t, err)
+	d := &delegate{cluster: b}
+	d.MergeRemoteState(d.LocalState(false), false)
+	d.MergeRemoteState((&delegate{cluster: a}).LocalState(false), false)
+
+	key := opinionKey{node: "a", breaker: "db"}
+	require.Equal(t, gedcb.Suspicion, b.opinions[key].State)
+
+	// opinions about breakers created after the exchange are applied on creation
+	now := time.Now()
+	db := b.Breaker("db")
+	for i := 0; i <= b.config.Breaker.SoftFailureThreshold; i++ {
+		require.NoError(t, db.Failure(now))
+	}
+	require.Equal(t, gedcb.Open, db.State(now))
+
+	// a stale state does not override a newer broadcast
+	message, err := CircuitBreakerBroadcast{Node: "a", Breaker: "db", Incarnation: a.incarnation, Version: 5, State: gedcb.Closed}.MarshalBinary()
+	require.NoError(t, err)
+	d.NotifyMsg(message)
+	d.MergeRemoteState((&delegate{cluster: a}).LocalState(false), false)
+	require.Equal(t, gedcb.Closed, b.opinions[key].State)
+	require.Equal(t, 5, b.opinions[key].Version)
+
+	// peers cannot override the local node's own opinions
+	message, err = CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: b.incarnation, Version: 100, State: gedcb.Open}.MarshalBinary()
+	require.NoError(t, err)
+	d.MergeRemoteState(encodeMessages(stateMessage, [][]byte{message}), false)
+	require.NotEqual(t, 100, b.opinions[opinionKey{node: "b", breaker: "db"}].Version)
+
+	d.MergeRemoteState([]byte("garbage"), false)
+	require.Equal(t, uint64(1), b.Stats().DroppedMessages)
+}
@@ -0,0 +1,237 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWatchInterval is how often a FileDiscovery without an Interval checks its file for changes.
+const defaultWatchInterval = 5 * time.Second
+
+// Discovery finds the addresses of peers to join. Addresses are host:port pairs, where the host may be a name memberlist resolves.
+type Discovery interface {
+	Peers(ctx context.Context) ([]string, error)
+}
+
+// Watcher is implemented by discoveries that can tell when their peers may have changed,
+// so that the cluster joins new peers without waiting for its next join attempt.
+type Watcher interface {
+	// Watch returns a channel that receives a value whenever the peers may have changed. It is closed once the context is done.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// StaticPeers is a fixed list of peer addresses.
+type StaticPeers []string
+
+func (s StaticPeers) Peers(context.Context) ([]string, error) {
+	return append([]string(nil), s...), nil
+}
+
+// DNSDiscovery finds peers by looking up the A and AAAA records of a name, such as a Kubernetes headless service.
+// Every peer is assumed to gossip on Port.
+type DNSDiscovery struct {
+	Name string
+	Port int
+	// Resolver defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+func (d DNSDiscovery) Peers(ctx context.Context) ([]string, error) {
+	ipAddresses, err := resolver(d.Resolver).LookupIPAddr(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(ipAddresses))
+	for _, peer := range ipAddresses {
+		addresses = append(addresses, net.JoinHostPort(peer.String(), strconv.Itoa(d.Port)))
+	}
+
+	return addresses, nil
+}
+
+// SRVDiscovery finds peers by looking up the SRV records of a service, so that each peer's port comes from DNS.
+// Service and Proto may be empty to look up Name directly, as in "_gossip._udp.example.svc.cluster.local".
+type SRVDiscovery struct {
+	Service string
+	Proto   string
+	Name    string
+	// Resolver defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+func (d SRVDiscovery) Peers(ctx context.Context) ([]string, error) {
+	_, records, err := resolver(d.Resolver).LookupSRV(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		addresses = append(addresses, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+	}
+
+	return addresses, nil
+}
+
+func resolver(resolver *net.Resolver) *net.Resolver {
+	if resolver == nil {
+		return net.DefaultResolver
+	}
+
+	return resolver
+}
+
+// FileDiscovery reads peer addresses from a file, one per line or separated by white space, ignoring lines starting with #.
+// The file is read on every lookup, and watched for changes every Interval, or five seconds if Interval is zero.
+type FileDiscovery struct {
+	Path     string
+	Interval time.Duration
+}
+
+func (d FileDiscovery) Peers(context.Context) ([]string, error) {
+	data, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		addresses = append(addresses, strings.Fields(line)...)
+	}
+
+	return addresses, nil
+}
+
+// Watch signals when the file's contents change, including when it is created or removed.
+func (d FileDiscovery) Watch(ctx context.Context) <-chan struct{} {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	// compare contents rather than modification times, since Kubernetes swaps mounted files through symbolic links.
+	last, _ := os.ReadFile(d.Path)
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				data, _ := os.ReadFile(d.Path)
+				if bytes.Equal(data, last) {
+					continue
+				}
+
+				last = data
+				notify(changes)
+			}
+		}
+	}()
+
+	return changes
+}
+
+// CompositeDiscovery merges the peers found by several discoveries, so that one of them failing does not prevent joining.
+type CompositeDiscovery []Discovery
+
+// Peers returns the distinct peers found by every discovery in order. It only fails if every discovery fails.
+func (c CompositeDiscovery) Peers(ctx context.Context) ([]string, error) {
+	var addresses []string
+	var failures []error
+
+	seen := make(map[string]bool)
+	for _, discovery := range c {
+		peers, err := discovery.Peers(ctx)
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+
+		for _, peer := range peers {
+			if !seen[peer] {
+				seen[peer] = true
+				addresses = append(addresses, peer)
+			}
+		}
+	}
+
+	if len(failures) > 0 && len(failures) == len(c) {
+		return nil, errors.Join(failures...)
+	}
+
+	return addresses, nil
+}
+
+// Watch signals whenever any of the discoveries that are watchers does.
+func (c CompositeDiscovery) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	var watches []<-chan struct{}
+	for _, discovery := range c {
+		if watcher, ok := discovery.(Watcher); ok {
+			watches = append(watches, watcher.Watch(ctx))
+		}
+	}
+
+	go func() {
+		defer close(changes)
+
+		done := make(chan struct{}, len(watches))
+		for _, watch := range watches {
+			go func(watch <-chan struct{}) {
+				for range watch {
+					notify(changes)
+				}
+
+				done <- struct{}{}
+			}(watch)
+		}
+
+		for range watches {
+			<-done
+		}
+
+		<-ctx.Done()
+	}()
+
+	return changes
+}
+
+// notify signals a change without blocking, since one pending signal covers any number of changes.
+func notify(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// discovery returns the configured Discovery, or one looking up the Cluster DNS name or returning the static Peers.
+func (c Config) discovery() Discovery {
+	if c.Discovery != nil {
+		return c.Discovery
+	}
+
+	if c.Cluster == "" || (c.Cluster == "localhost" && len(c.Peers) > 0) {
+		return StaticPeers(c.Peers)
+	}
+
+	return DNSDiscovery{Name: c.Cluster, Port: c.Memberlist.BindPort}
+}
@@ -0,0 +1,169 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// srvResolver returns a resolver answering every SRV query from a fake DNS server with the given records.
+func srvResolver(t *testing.T, records ...dnsmessage.SRVResource) *net.Resolver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err = query.Unpack(buffer[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+
+			response := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+			}
+
+			if query.Questions[0].Type == dnsmessage.TypeSRV {
+				for i := range records {
+					response.Answers = append(response.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: query.Questions[0].Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &records[i],
+					})
+				}
+			}
+
+			packed, err := response.Pack()
+			if err == nil {
+				_, _ = conn.WriteTo(packed, from)
+			}
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestSRVDiscovery(t *testing.T) {
+	resolver := srvResolver(t,
+		dnsmessage.SRVResource{Target: dnsmessage.MustNewName("a.gossip.example."), Port: 4001, Priority: 1, Weight: 1},
+		dnsmessage.SRVResource{Target: dnsmessage.MustNewName("b.gossip.example."), Port: 4002, Priority: 1, Weight: 1},
+	)
+
+	discovery := SRVDiscovery{Service: "gossip", Proto: "udp", Name: "example.", Resolver: resolver}
+	peers, err := discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a.gossip.example:4001", "b.gossip.example:4002"}, peers)
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	peers, err := DNSDiscovery{Name: "localhost", Port: 7946}.Peers(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, peers, "127.0.0.1:7946")
+}
+
+func TestFileDiscovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	require.NoError(t, os.WriteFile(path, []byte("# seeds\na:7946 b:7946\n\nc:7946\n"), 0600))
+
+	discovery := FileDiscovery{Path: path, Interval: 10 * time.Millisecond}
+	peers, err := discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:7946", "b:7946", "c:7946"}, peers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := discovery.Watch(ctx)
+
+	require.NoError(t, os.WriteFile(path, []byte("d:7946\n"), 0600))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not signalled")
+	}
+
+	peers, err = discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"d:7946"}, peers)
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestCompositeDiscovery(t *testing.T) {
+	missing := FileDiscovery{Path: filepath.Join(t.TempDir(), "missing")}
+	discovery := CompositeDiscovery{missing, StaticPeers{"a:7946", "b:7946"}, StaticPeers{"b:7946", "c:7946"}}
+
+	peers, err := discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:7946", "b:7946", "c:7946"}, peers)
+
+	_, err = CompositeDiscovery{missing}.Peers(context.Background())
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestJoinTriesSeveralPeers(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"))
+
+	// nothing listens on the closed port, so joining only succeeds by contacting a as well.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	config := newTestConfig("b")
+	config.Discovery = CompositeDiscovery{StaticPeers{closed}, StaticPeers{nodes[0].LocalNode().Address()}}
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, node.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = node.Shutdown(context.Background())
+	})
+
+	require.NoError(t, node.Join(context.Background()))
+	eventually(t, func() bool {
+		return len(nodes[0].Members()) == 2
+	})
+}
+
+func TestClusterJoinsWatchedPeers(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"))
+	path := filepath.Join(t.TempDir(), "peers")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+
+	config := newTestConfig("b")
+	config.Discovery = FileDiscovery{Path: path, Interval: 10 * time.Millisecond}
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, node.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = node.Shutdown(context.Background())
+	})
+
+	require.NoError(t, os.WriteFile(path, []byte(nodes[0].LocalNode().Address()), 0600))
+	eventually(t, func() bool {
+		return len(node.Members()) == 2
+	})
+}
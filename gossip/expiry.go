@@ -0,0 +1,126 @@
+package gossip
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// heartbeatsPerTTL is how many times per OpinionTTL the local node broadcasts its opinions again, so that losing a few of them does not
+// expire its opinions on its peers.
+const heartbeatsPerTTL = 4
+
+// reconcile periodically expires the opinions of peers that stopped gossiping, forgets the nodes that are no longer members, stops
+// counting the members that failed long ago towards the cluster size and elects the probers again.
+// With an OpinionTTL, it also broadcasts the local node's opinions again as a heartbeat.
+func (c *Cluster) reconcile(ctx context.Context) {
+	defer c.done.Done()
+
+	ticker := time.NewTicker(c.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	var heartbeats <-chan time.Time
+	if c.config.OpinionTTL > 0 {
+		heartbeat := time.NewTicker(c.config.OpinionTTL / heartbeatsPerTTL)
+		defer heartbeat.Stop()
+
+		heartbeats = heartbeat.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeats:
+			c.heartbeat()
+		case <-ticker.C:
+			c.forgetDeparted()
+			c.reapFailed(time.Now())
+			c.expireOpinions(time.Now())
+			c.reelectProbers()
+		}
+	}
+}
+
+// heartbeat queues the local node's opinions about every breaker again, so that peers do not expire them while they are unchanged.
+func (c *Cluster) heartbeat() {
+	for _, name := range c.Breakers() {
+		c.markDirty(name)
+	}
+}
+
+// forgetDeparted forgets the nodes with opinions or metadata that are no longer members, in case memberlist did not notify their leave.
+func (c *Cluster) forgetDeparted() {
+	members := c.memberNames()
+	if members == nil {
+		return
+	}
+
+	departed := make(map[string]bool)
+
+	c.mutex.Lock()
+	for key := range c.opinions {
+		if key.node != c.name && !members[key.node] {
+			departed[key.node] = true
+		}
+	}
+
+	for node := range c.peerMeta {
+		if !members[node] {
+			departed[node] = true
+		}
+	}
+
+	var dead []string
+	for node := range c.live {
+		if !members[node] {
+			dead = append(dead, node)
+		}
+	}
+	c.mutex.Unlock()
+
+	// stop counting them as alive too, which elects another prober for the breakers they probed.
+	for _, node := range dead {
+		c.memberLeft(&memberlist.Node{Name: node, State: memberlist.StateDead})
+	}
+
+	for node := range departed {
+		c.config.Logger.Printf("forgetting %s, which is no longer a member\n", node)
+		c.forgetNode(node)
+	}
+}
+
+// reelectProbers elects the probers again, for the next ProbePeriod or the members' latest metadata.
+func (c *Cluster) reelectProbers() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.electProbers(time.Now())
+}
+
+// expireOpinions stops counting the peers' opinions that were not superseded within the OpinionTTL, such as the last opinions of a
+// wedged process that is still a member. Expired opinions are kept, without a vote, so that older copies relayed by other peers are ignored,
+// until a newer opinion arrives.
+func (c *Cluster) expireOpinions(now time.Time) {
+	if c.config.OpinionTTL <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, heard := range c.heard {
+		if c.expired[key] || now.Sub(heard) < c.config.OpinionTTL {
+			continue
+		}
+
+		c.expired[key] = true
+		c.stats.expiredOpinions.Add(1)
+		c.config.Logger.Printf("opinion of %s about %s expired, last heard %v ago\n", key.node, key.breaker, now.Sub(heard))
+
+		if breaker, found := c.breakers[key.breaker]; found {
+			breaker.DeletePeer(key.node)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpireOpinions(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	breaker := node.Breaker("db")
+	opinion := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}
+	require.True(t, node.applyOpinion(opinion, "test"))
+
+	node.expireOpinions(time.Now())
+	require.Equal(t, uint64(0), node.Stats().ExpiredOpinions)
+
+	node.expireOpinions(time.Now().Add(node.config.OpinionTTL))
+	require.Equal(t, uint64(1), node.Stats().ExpiredOpinions)
+
+	// b's expired opinion no longer counts, nor is it shared with peers
+	suspect(t, breaker, node.config.Breaker)
+	opinions, err := DecodeMessage(node.localState())
+	require.NoError(t, err)
+	for _, shared := range opinions {
+		require.NotEqual(t, "b", shared.Node)
+	}
+
+	// a copy relayed by another peer does not revive it, but a newer opinion does
+	require.False(t, node.applyOpinion(opinion, "test"))
+	opinion.Version++
+	require.True(t, node.applyOpinion(opinion, "test"))
+	require.Equal(t, gedcb.Open, breaker.State(time.Now()))
+}
+
+func TestForgetDeparted(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"), newTestConfig("b"))
+
+	nodes[0].Breaker("db")
+	nodes[1].Breaker("db")
+	eventually(t, func() bool {
+		return hasOpinion(nodes[0], "b", "db")
+	})
+
+	// a node that left without memberlist telling the local node
+	require.True(t, nodes[0].applyOpinion(CircuitBreakerBroadcast{Node: "c", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}, "test"))
+
+	nodes[0].forgetDeparted()
+	require.False(t, hasOpinion(nodes[0], "c", "db"))
+	require.True(t, hasOpinion(nodes[0], "b", "db"))
+}
+
+func TestClusterHeartbeat(t *testing.T) {
+	a, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	b, err := NewCluster(newTestConfig("b"))
+	require.NoError(t, err)
+
+	a.Breaker("db")
+	b.Breaker("db")
+
+	// a's opinion never changes, but each heartbeat refreshes it on b within the OpinionTTL
+	key := opinionKey{node: "a", breaker: "db"}
+	version := 0
+	for i := 0; i < 2*heartbeatsPerTTL; i++ {
+		a.heartbeat()
+		for _, message := range (&delegate{cluster: a}).GetBroadcasts(0, 1024) {
+			(&delegate{cluster: b}).NotifyMsg(message)
+		}
+
+		b.mutex.Lock()
+		heard, opinion := b.heard[key], b.opinions[key]
+		b.mutex.Unlock()
+
+		require.Greater(t, opinion.Version, version, "heartbeat %d did not reach b", i)
+		version = opinion.Version
+		b.expireOpinions(heard.Add(b.config.OpinionTTL - time.Nanosecond))
+		require.Equal(t, uint64(0), b.Stats().ExpiredOpinions)
+	}
+
+	// without another heartbeat, it expires
+	b.mutex.Lock()
+	heard := b.heard[key]
+	b.mutex.Unlock()
+
+	b.expireOpinions(heard.Add(b.config.OpinionTTL))
+	require.Equal(t, uint64(1), b.Stats().ExpiredOpinions)
+}
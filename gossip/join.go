@@ -0,0 +1,257 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// JoinStatus tells whether the local node is part of a cluster, for readiness probes.
+type JoinStatus int32
+
+const (
+	// Alone means no peers were found to join, so the node forms a cluster on its own, such as the first node of a new cluster.
+	Alone JoinStatus = iota
+	// Joining means the node found peers but has not contacted any of them yet.
+	Joining
+	// Joined means the node is a member of a cluster with other nodes.
+	Joined
+	// Degraded means the node was a member of a cluster but lost every other member, or failed to contact any peer since.
+	Degraded
+)
+
+func (s JoinStatus) String() string {
+	switch s {
+	case Alone:
+		return "alone"
+	case Joining:
+		return "joining"
+	case Joined:
+		return "joined"
+	case Degraded:
+		return "degraded"
+	default:
+		return fmt.Sprintf("JoinStatus(%d)", int(s))
+	}
+}
+
+// Ready returns true if the node is part of a cluster or has no peers to wait for.
+func (s JoinStatus) Ready() bool {
+	return s == Alone || s == Joined
+}
+
+// joinStatus holds the JoinStatus of the last join attempt.
+type joinStatus struct {
+	value atomic.Int32
+}
+
+func (s *joinStatus) load() JoinStatus {
+	return JoinStatus(s.value.Load())
+}
+
+func (s *joinStatus) store(status JoinStatus) {
+	s.value.Store(int32(status))
+}
+
+// JoinStatus returns whether the local node is part of a cluster. A joined node that lost every other member is Degraded.
+func (c *Cluster) JoinStatus() JoinStatus {
+	status := c.joinState.load()
+	if status == Joined && c.numMembers() <= 1 {
+		return Degraded
+	}
+
+	return status
+}
+
+// Join contacts up to JoinPeers random peers in parallel, found by the Discovery, or via the Cluster DNS name or the static Peers,
+// to join their cluster. It succeeds if any of them is contacted, and returns once every contact completes or the context is done.
+func (c *Cluster) Join(ctx context.Context) error {
+	if c.members == nil {
+		return NotStartedErr
+	}
+
+	start := time.Now()
+	wasJoined := c.joinState.load() == Joined || c.joinState.load() == Degraded
+
+	peers, err := c.fetchPeers(ctx)
+	if err != nil {
+		c.failJoin(wasJoined)
+		return err
+	}
+
+	if len(peers) == 0 {
+		if c.numMembers() > 1 {
+			c.joinState.store(Joined)
+		} else if !wasJoined {
+			c.joinState.store(Alone)
+		} else {
+			c.joinState.store(Degraded)
+		}
+
+		c.config.Logger.Println("no peers to join")
+		return nil
+	}
+
+	if !wasJoined {
+		c.joinState.store(Joining)
+	}
+
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+
+	peers = peers[:min(len(peers), c.config.JoinPeers)]
+
+	c.config.Logger.Printf("attempting to join %v nodes from %s to the cluster with %d members\n", peers, c.members.LocalNode().Address(), c.members.NumMembers())
+
+	results := make(chan error, len(peers))
+	for _, peer := range peers {
+		go func(peer string) {
+			_, err := c.members.Join([]string{peer})
+			results <- err
+		}(peer)
+	}
+
+	var failures []error
+	for range peers {
+		select {
+		case <-ctx.Done():
+			c.failJoin(wasJoined)
+			return ctx.Err()
+		case err = <-results:
+			if err != nil {
+				failures = append(failures, err)
+			}
+		}
+	}
+
+	if len(failures) == len(peers) {
+		c.failJoin(wasJoined)
+		return errors.Join(failures...)
+	}
+
+	c.joinState.store(Joined)
+	c.config.Logger.Printf("successfully connected %d nodes after %f seconds\n", len(peers)-len(failures), time.Since(start).Seconds())
+
+	return nil
+}
+
+// failJoin records a failed join attempt. A node that never joined is still joining, while a node that had joined is degraded.
+func (c *Cluster) failJoin(wasJoined bool) {
+	if wasJoined {
+		c.joinState.store(Degraded)
+	} else {
+		c.joinState.store(Joining)
+	}
+}
+
+// JoinLoop joins the cluster and keeps it joined until the context is done. Failed attempts are retried with exponential backoff and jitter,
+// from JoinRetryMin up to JoinRetryMax. Once joined, the node joins again every JoinRetryMax to heal partitions and meet new peers,
+// and retries sooner if it becomes Degraded.
+func (c *Cluster) JoinLoop(ctx context.Context) error {
+	if c.members == nil {
+		return NotStartedErr
+	}
+
+	attempt := 0
+	for {
+		err := c.Join(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			c.config.Logger.Println("failed to join cluster", err)
+		}
+
+		delay := c.config.JoinRetryMax
+		if c.JoinStatus() == Joined {
+			attempt = 0
+		} else {
+			delay = backoff(attempt, c.config.JoinRetryMin, c.config.JoinRetryMax)
+			attempt++
+		}
+
+		if !c.waitToJoin(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+}
+
+// waitToJoin waits for the delay to pass, returning early if a joined node becomes degraded. It returns false once the context is done.
+func (c *Cluster) waitToJoin(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(min(delay, c.config.JoinRetryMin))
+	defer ticker.Stop()
+
+	joined := c.JoinStatus() == Joined
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-ticker.C:
+			if joined && c.JoinStatus() != Joined {
+				return true
+			}
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt after the given number of failed ones: it doubles from initial up to limit,
+// and a random half of it is dropped so nodes started together do not retry in lockstep.
+func backoff(attempt int, initial, limit time.Duration) time.Duration {
+	delay := initial
+	for i := 0; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, limit)
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// fetchPeers returns the addresses of discovered peers that are not yet members of the cluster.
+func (c *Cluster) fetchPeers(ctx context.Context) ([]string, error) {
+	peers, err := c.discovery.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.filterPeers(peers), nil
+}
+
+// watchPeers joins the newly discovered peers whenever the discovery signals a change.
+func (c *Cluster) watchPeers(ctx context.Context, changes <-chan struct{}) {
+	defer c.done.Done()
+
+	for range changes {
+		if err := c.Join(ctx); err != nil && ctx.Err() == nil {
+			c.config.Logger.Println("failed to join discovered peers", err)
+		}
+	}
+}
+
+// filterPeers removes the addresses of current members from the given peers.
+func (c *Cluster) filterPeers(peers []string) []string {
+	filtered := make([]string, 0, len(peers))
+
+OuterLoop:
+	for _, peer := range peers {
+		for _, node := range c.members.Members() {
+			if node.Address() == peer {
+				continue OuterLoop
+			}
+		}
+
+		filtered = append(filtered, peer)
+	}
+
+	return filtered
+}
@@ -0,0 +1,132 @@
+package gossip
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mutablePeers is a discovery whose peers the test changes.
+type mutablePeers struct {
+	peers []string
+	mutex sync.Mutex
+}
+
+func (m *mutablePeers) Peers(context.Context) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]string(nil), m.peers...), nil
+}
+
+func (m *mutablePeers) set(peers ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.peers = peers
+}
+
+// closedAddress returns a local address nothing listens on.
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	return listener.Addr().String()
+}
+
+func TestBackoff(t *testing.T) {
+	expected := time.Second
+	for attempt := 0; attempt < 100; attempt++ {
+		delay := backoff(attempt, time.Second, time.Minute)
+		if attempt > 0 {
+			expected = min(2*expected, time.Minute)
+		}
+
+		require.True(t, delay >= expected/2, "attempt %d waits %v", attempt, delay)
+		require.True(t, delay <= expected, "attempt %d waits %v", attempt, delay)
+	}
+}
+
+func TestJoinStatus(t *testing.T) {
+	ctx := context.Background()
+	nodes := startTestCluster(t, newTestConfig("a"))
+	require.Equal(t, Alone, nodes[0].JoinStatus())
+	require.True(t, nodes[0].JoinStatus().Ready())
+
+	peers := &mutablePeers{}
+	peers.set(closedAddress(t))
+
+	config := newTestConfig("b")
+	config.Discovery = peers
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, node.Start(ctx))
+	t.Cleanup(func() {
+		_ = node.Shutdown(ctx)
+	})
+
+	require.Error(t, node.Join(ctx))
+	require.Equal(t, Joining, node.JoinStatus())
+	require.False(t, node.JoinStatus().Ready())
+
+	peers.set(nodes[0].LocalNode().Address())
+	require.NoError(t, node.Join(ctx))
+	require.Equal(t, Joined, node.JoinStatus())
+
+	// a joined node that loses its peers is degraded until it joins again
+	eventually(t, func() bool {
+		return len(nodes[0].Members()) == 2
+	})
+	require.NoError(t, nodes[0].Leave(ctx))
+	eventually(t, func() bool {
+		return node.JoinStatus() == Degraded
+	})
+
+	peers.set(closedAddress(t))
+	require.Error(t, node.Join(ctx))
+	require.Equal(t, Degraded, node.JoinStatus())
+}
+
+func TestJoinLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	nodes := startTestCluster(t, newTestConfig("a"))
+
+	peers := &mutablePeers{}
+	peers.set(closedAddress(t))
+
+	config := newTestConfig("b")
+	config.Discovery = peers
+	config.JoinRetryMin = 10 * time.Millisecond
+	config.JoinRetryMax = 50 * time.Millisecond
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, node.Start(ctx))
+	t.Cleanup(func() {
+		_ = node.Shutdown(context.Background())
+	})
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- node.JoinLoop(ctx)
+	}()
+
+	eventually(t, func() bool {
+		return node.JoinStatus() == Joining
+	})
+
+	// the loop keeps retrying until the peer can be reached
+	peers.set(nodes[0].LocalNode().Address())
+	eventually(t, func() bool {
+		return node.JoinStatus() == Joined && len(nodes[0].Members()) == 2
+	})
+
+	cancel()
+	require.Equal(t, context.Canceled, <-stopped)
+}
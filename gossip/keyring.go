@@ -0,0 +1,269 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// primaryKeyFile names the file holding the primary key in a keyring directory.
+const primaryKeyFile = "primary"
+
+// NoKeyringErr is returned by key operations when gossip encryption is not configured.
+var NoKeyringErr = errors.New("gossip encryption is not configured")
+
+// EmptyKeyringErr is returned when a keyring file or directory contains no keys.
+var EmptyKeyringErr = errors.New("keyring contains no keys")
+
+// LoadKeyring reads a keyring of base64 encoded AES keys, one per line, from a file or a directory such as a mounted Kubernetes secret.
+// In a file the first key is the primary key. In a directory every file not starting with a dot is read in name order,
+// and the first key of the file named "primary", if any, is the primary key instead.
+func LoadKeyring(path string) (*memberlist.Keyring, error) {
+	keys, primary, err := readKeys(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return memberlist.NewKeyring(keys, primary)
+}
+
+// readKeys returns the distinct keys found at path and the primary key.
+func readKeys(path string) ([][]byte, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = files[:0]
+		for _, entry := range entries {
+			// Kubernetes mounts secrets through hidden ..data directories, whose files are linked from the visible names.
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+				continue
+			}
+
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+
+		sort.Strings(files)
+	}
+
+	var keys [][]byte
+	var primary []byte
+
+	for _, file := range files {
+		fileKeys, err := readKeyFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(fileKeys) > 0 && (primary == nil || (info.IsDir() && filepath.Base(file) == primaryKeyFile)) {
+			primary = fileKeys[0]
+		}
+
+		for _, key := range fileKeys {
+			if !containsKey(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", EmptyKeyringErr, path)
+	}
+
+	return keys, primary, nil
+}
+
+// readKeyFile decodes the base64 keys in a file, one per line, ignoring blank lines.
+func readKeyFile(file string) ([][]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, i+1, err)
+		}
+
+		if err = memberlist.ValidateKey(key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, i+1, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, other := range keys {
+		if bytes.Equal(other, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameKeys returns true if both lists hold the same keys, in any order.
+func sameKeys(keys [][]byte, others [][]byte) bool {
+	if len(keys) != len(others) {
+		return false
+	}
+
+	for _, key := range keys {
+		if !containsKey(others, key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// KeyFingerprint identifies a key without revealing it, for logs and admin tools.
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// withKeyring calls f with the memberlist keyring, which is shared with the running memberlist.
+// Changes are serialized because the keyring only locks its own reads of the keys while installing them.
+func (c *Cluster) withKeyring(f func(keyring *memberlist.Keyring) error) error {
+	if c.config.Memberlist.Keyring == nil {
+		return NoKeyringErr
+	}
+
+	c.keyMutex.Lock()
+	defer c.keyMutex.Unlock()
+
+	return f(c.config.Memberlist.Keyring)
+}
+
+// InstallKey adds a key that the local node accepts for decryption. Install a new key on every node before using it.
+func (c *Cluster) InstallKey(key []byte) error {
+	return c.withKeyring(func(keyring *memberlist.Keyring) error {
+		return keyring.AddKey(key)
+	})
+}
+
+// UseKey makes an installed key the primary key, used to encrypt outgoing messages.
+func (c *Cluster) UseKey(key []byte) error {
+	return c.withKeyring(func(keyring *memberlist.Keyring) error {
+		return keyring.UseKey(key)
+	})
+}
+
+// RemoveKey stops accepting a key. The primary key cannot be removed.
+func (c *Cluster) RemoveKey(key []byte) error {
+	return c.withKeyring(func(keyring *memberlist.Keyring) error {
+		return keyring.RemoveKey(key)
+	})
+}
+
+// ListKeys returns the installed keys, starting with the primary key.
+func (c *Cluster) ListKeys() ([][]byte, error) {
+	var keys [][]byte
+	err := c.withKeyring(func(keyring *memberlist.Keyring) error {
+		keys = keyring.GetKeys()
+		return nil
+	})
+
+	return keys, err
+}
+
+// ReloadKeyring re-reads the configured KeyringPath and applies it: new keys are installed, the primary key is used,
+// then keys no longer listed are removed. Rotating a key without downtime takes three reloads, rolled out to every node in turn:
+// add the new key, make it primary, then remove the old key. Reloading an unchanged keyring does nothing, so it can be polled.
+func (c *Cluster) ReloadKeyring() error {
+	if c.config.KeyringPath == "" {
+		return NoKeyringErr
+	}
+
+	keys, primary, err := readKeys(c.config.KeyringPath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	err = c.withKeyring(func(keyring *memberlist.Keyring) error {
+		if current := keyring.GetKeys(); len(current) > 0 && sameKeys(current, keys) && bytes.Equal(current[0], primary) {
+			return nil
+		}
+
+		changed = true
+		for _, key := range keys {
+			if err := keyring.AddKey(key); err != nil {
+				return err
+			}
+		}
+
+		if err := keyring.UseKey(primary); err != nil {
+			return err
+		}
+
+		for _, key := range keyring.GetKeys() {
+			if containsKey(keys, key) {
+				continue
+			}
+
+			if err := keyring.RemoveKey(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	c.config.Logger.Printf("reloaded keyring with %d keys, primary %s\n", len(keys), KeyFingerprint(primary))
+
+	return nil
+}
+
+// reloadKeyring periodically reloads the keyring, so that keys are rotated by updating the file or mounted secret.
+func (c *Cluster) reloadKeyring(ctx context.Context) {
+	defer c.done.Done()
+
+	ticker := time.NewTicker(c.config.KeyringInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.ReloadKeyring(); err != nil {
+				c.config.Logger.Println("failed to reload the keyring", err)
+			}
+		}
+	}
+}
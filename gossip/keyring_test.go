@@ -0,0 +1,234 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKey returns a 16 byte AES key filled with the given byte.
+func newTestKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 16)
+}
+
+// writeKeyring writes the base64 encoded keys, one per line, to a file.
+func writeKeyring(t *testing.T, path string, keys ...[]byte) string {
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, base64.StdEncoding.EncodeToString(key))
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	return path
+}
+
+func TestLoadKeyringFile(t *testing.T) {
+	path := writeKeyring(t, filepath.Join(t.TempDir(), "keyring"), newTestKey(2), newTestKey(1), newTestKey(2))
+
+	keyring, err := LoadKeyring(path)
+	require.NoError(t, err)
+	require.Equal(t, newTestKey(2), keyring.GetPrimaryKey())
+	require.Len(t, keyring.GetKeys(), 2)
+}
+
+func TestLoadKeyringSecretMount(t *testing.T) {
+	// Kubernetes mounts each key of a secret as a link into a hidden, atomically swapped directory.
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2024_01_01_00_00_00.000000000")
+	require.NoError(t, os.Mkdir(data, 0o700))
+	writeKeyring(t, filepath.Join(data, "old"), newTestKey(1))
+	writeKeyring(t, filepath.Join(data, "primary"), newTestKey(2))
+	require.NoError(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "old"), filepath.Join(dir, "old")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "primary"), filepath.Join(dir, "primary")))
+
+	keyring, err := LoadKeyring(dir)
+	require.NoError(t, err)
+	require.Equal(t, newTestKey(2), keyring.GetPrimaryKey())
+	require.Equal(t, [][]byte{newTestKey(2), newTestKey(1)}, keyring.GetKeys())
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := LoadKeyring(writeKeyring(t, filepath.Join(dir, "empty")))
+	require.True(t, errors.Is(err, EmptyKeyringErr))
+
+	_, err = LoadKeyring(writeKeyring(t, filepath.Join(dir, "short"), []byte("short")))
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid"), []byte("not base64!"), 0o600))
+	_, err = LoadKeyring(filepath.Join(dir, "invalid"))
+	require.Error(t, err)
+
+	_, err = LoadKeyring(filepath.Join(dir, "missing"))
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestClusterKeysWithoutKeyring(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	_, err = node.ListKeys()
+	require.Equal(t, NoKeyringErr, err)
+	require.Equal(t, NoKeyringErr, node.InstallKey(newTestKey(1)))
+	require.Equal(t, NoKeyringErr, node.ReloadKeyring())
+}
+
+func TestClusterReloadKeyringUnchanged(t *testing.T) {
+	var logs bytes.Buffer
+	config := newTestConfig("a")
+	config.KeyringPath = writeKeyring(t, filepath.Join(t.TempDir(), "keyring"), newTestKey(1), newTestKey(2))
+	config.Logger = log.New(&logs, "", 0)
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	// polling an unchanged keyring does nothing, but a new primary key is applied
+	require.NoError(t, node.ReloadKeyring())
+	require.Empty(t, logs.String())
+
+	writeKeyring(t, config.KeyringPath, newTestKey(2), newTestKey(1))
+	require.NoError(t, node.ReloadKeyring())
+	require.Contains(t, logs.String(), "reloaded keyring with 2 keys")
+
+	keys, err := node.ListKeys()
+	require.NoError(t, err)
+	require.Equal(t, newTestKey(2), keys[0])
+}
+
+func TestClusterKeyringInterval(t *testing.T) {
+	config := newTestConfig("a")
+	config.KeyringPath = writeKeyring(t, filepath.Join(t.TempDir(), "keyring"), newTestKey(1))
+	config.KeyringInterval = 10 * time.Millisecond
+	node := startTestCluster(t, config)[0]
+
+	// the started cluster applies the rotated keyring on its own
+	writeKeyring(t, config.KeyringPath, newTestKey(2), newTestKey(1))
+	eventually(t, func() bool {
+		keys, err := node.ListKeys()
+		return err == nil && bytes.Equal(newTestKey(2), keys[0])
+	})
+}
+
+func TestClusterWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	shared := writeKeyring(t, filepath.Join(dir, "shared"), newTestKey(1))
+
+	a, b := newTestConfig("a"), newTestConfig("b")
+	a.KeyringPath, b.KeyringPath = shared, shared
+	nodes := startTestCluster(t, a, b)
+	nodes[0].Breaker("db")
+	nodes[1].Breaker("db")
+
+	eventually(t, func() bool {
+		return hasOpinion(nodes[0], "b", "db")
+	})
+
+	config := newTestConfig("c")
+	config.KeyringPath = writeKeyring(t, filepath.Join(dir, "wrong"), newTestKey(2))
+	config.Peers = []string{nodes[0].LocalNode().Address()}
+
+	c, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, c.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = c.Shutdown(context.Background())
+	})
+	require.Error(t, c.Join(context.Background()))
+
+	// c impersonates b with an opinion that would win every comparison
+	forged, err := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: math.MaxInt64, Version: 1, State: gedcb.Open}.MarshalBinary()
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.members.SendBestEffort(nodes[0].LocalNode(), forged))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, nodes[0].Members(), 2)
+	require.Equal(t, gedcb.Suspicion, suspectState(t, nodes[0].Breaker("db")))
+}
+
+func TestClusterKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := newTestKey(1), newTestKey(2)
+	path := writeKeyring(t, filepath.Join(dir, "keyring"), oldKey)
+
+	a, b := newTestConfig("a"), newTestConfig("b")
+	a.KeyringPath, b.KeyringPath = path, path
+	nodes := startTestCluster(t, a, b)
+
+	// install the new key everywhere before using it, and use it everywhere before removing the old one
+	writeKeyring(t, path, oldKey, newKey)
+	for _, node := range nodes {
+		require.NoError(t, node.ReloadKeyring())
+	}
+
+	for _, node := range nodes {
+		require.NoError(t, node.UseKey(newKey))
+	}
+
+	for _, node := range nodes {
+		require.NoError(t, node.RemoveKey(oldKey))
+
+		keys, err := node.ListKeys()
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{newKey}, keys)
+	}
+
+	suspect(t, nodes[0].Breaker("db"), a.Breaker)
+	suspect(t, nodes[1].Breaker("db"), b.Breaker)
+	eventually(t, func() bool {
+		return peerSuspects(nodes[0], "b", "db") && peerSuspects(nodes[1], "a", "db")
+	})
+
+	// a node that only knows the new key joins and counts the votes of the existing nodes
+	config := newTestConfig("c")
+	config.KeyringPath = writeKeyring(t, filepath.Join(dir, "new"), newKey)
+	config.Peers = []string{nodes[0].LocalNode().Address()}
+
+	c, err := NewCluster(config)
+	require.NoError(t, err)
+	require.NoError(t, c.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = c.Shutdown(context.Background())
+	})
+	require.NoError(t, c.Join(context.Background()))
+
+	eventually(t, func() bool {
+		return peerSuspects(c, "a", "db") && peerSuspects(c, "b", "db")
+	})
+	require.Equal(t, gedcb.Open, suspectState(t, c.Breaker("db")))
+}
+
+// hasOpinion returns true if the node knows the given peer's opinion about the breaker.
+func hasOpinion(node *Cluster, peer, breaker string) bool {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	_, found := node.opinions[opinionKey{node: peer, breaker: breaker}]
+
+	return found
+}
+
+// suspectState records enough failures for the breaker to suspect a failure on its own and returns its resulting state.
+func suspectState(t *testing.T, breaker *gedcb.Breaker) gedcb.State {
+	now := time.Now()
+	for i := 0; i <= breaker.Config().SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(now))
+	}
+
+	return breaker.State(now)
+}
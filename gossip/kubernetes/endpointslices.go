@@ -0,0 +1,136 @@
+// Package kubernetes discovers gossip peers from the EndpointSlices of a Kubernetes service.
+// It is kept apart from the gossip package so that only programs running in Kubernetes depend on client-go.
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// retryInterval is how long to wait before watching again after a watch fails to start.
+const retryInterval = 5 * time.Second
+
+// EndpointSlices finds the ready endpoints of a service, implementing gossip.Discovery and gossip.Watcher.
+// Unlike DNS, it sees pods as soon as the control plane does and is not subject to caching.
+type EndpointSlices struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Service   string
+	// PortName selects the service port peers gossip on. Port is used when PortName is empty or not found in a slice.
+	PortName string
+	Port     int
+}
+
+// InCluster creates an EndpointSlices discovery using the credentials of the pod's service account.
+// The service account needs permission to list and watch EndpointSlices in the namespace.
+func InCluster(namespace, service string, port int) (*EndpointSlices, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EndpointSlices{Client: client, Namespace: namespace, Service: service, Port: port}, nil
+}
+
+// listOptions selects the EndpointSlices of the service.
+func (e *EndpointSlices) listOptions() metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: discoveryv1.LabelServiceName + "=" + e.Service}
+}
+
+// Peers returns the addresses of the service's ready endpoints. Endpoints without readiness information are assumed ready.
+func (e *EndpointSlices) Peers(ctx context.Context) ([]string, error) {
+	slices, err := e.Client.DiscoveryV1().EndpointSlices(e.Namespace).List(ctx, e.listOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, slice := range slices.Items {
+		port := strconv.Itoa(e.port(slice))
+
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+
+			for _, address := range endpoint.Addresses {
+				addresses = append(addresses, net.JoinHostPort(address, port))
+			}
+		}
+	}
+
+	return addresses, nil
+}
+
+// port returns the slice's port named PortName, or Port.
+func (e *EndpointSlices) port(slice discoveryv1.EndpointSlice) int {
+	if e.PortName == "" {
+		return e.Port
+	}
+
+	for _, port := range slice.Ports {
+		if port.Name != nil && *port.Name == e.PortName && port.Port != nil {
+			return int(*port.Port)
+		}
+	}
+
+	return e.Port
+}
+
+// Watch signals whenever one of the service's EndpointSlices changes. The watch is established again after the API server ends it,
+// waiting RetryInterval after a failure.
+func (e *EndpointSlices) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+
+		for ctx.Err() == nil {
+			if err := e.watch(ctx, changes); err != nil {
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryInterval):
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// watch signals changes until the watch ends or the context is done.
+func (e *EndpointSlices) watch(ctx context.Context, changes chan<- struct{}) error {
+	watch, err := e.Client.DiscoveryV1().EndpointSlices(e.Namespace).Watch(ctx, e.listOptions())
+	if err != nil {
+		return err
+	}
+	defer watch.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-watch.ResultChan():
+			if !ok {
+				return nil
+			}
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
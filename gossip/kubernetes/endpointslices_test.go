@@ -0,0 +1,75 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSlice(name, service string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	portName := "gossip"
+
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+}
+
+func newEndpoint(ready bool, addresses ...string) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{Addresses: addresses, Conditions: discoveryv1.EndpointConditions{Ready: &ready}}
+}
+
+func TestEndpointSlicesPeers(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newSlice("gossip-1", "gossip", 4001, newEndpoint(true, "10.0.0.1"), newEndpoint(false, "10.0.0.2")),
+		newSlice("gossip-2", "gossip", 4001, discoveryv1.Endpoint{Addresses: []string{"10.0.0.3"}}),
+		newSlice("other-1", "other", 4001, newEndpoint(true, "10.0.1.1")),
+	)
+
+	discovery := &EndpointSlices{Client: client, Namespace: "default", Service: "gossip", PortName: "gossip", Port: 7946}
+	peers, err := discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"10.0.0.1:4001", "10.0.0.3:4001"}, peers)
+
+	discovery.PortName = ""
+	peers, err = discovery.Peers(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"10.0.0.1:7946", "10.0.0.3:7946"}, peers)
+}
+
+func TestEndpointSlicesWatch(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	discovery := &EndpointSlices{Client: client, Namespace: "default", Service: "gossip", Port: 7946}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := discovery.Watch(ctx)
+
+	// the fake client only delivers the events that happen after the watch starts, so keep creating slices until one is seen.
+	deadline := time.After(5 * time.Second)
+	for i := 0; ; i++ {
+		slice := newSlice("gossip-"+string(rune('a'+i)), "gossip", 7946, newEndpoint(true, "10.0.0.1"))
+		_, err := client.DiscoveryV1().EndpointSlices("default").Create(ctx, slice, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		select {
+		case <-changes:
+			return
+		case <-deadline:
+			t.Fatal("change not signalled")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
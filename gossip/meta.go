@@ -0,0 +1,311 @@
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+)
+
+// Flags of a metadata message.
+const (
+	metaTruncated byte = 1 << iota
+	metaPublicKey
+)
+
+// NodeMeta is the metadata a node advertises in its memberlist membership, so peers learn about it without extra messages.
+type NodeMeta struct {
+	// Zone is the node's availability zone, if configured.
+	Zone string
+	// Incarnation is the node's current incarnation, see Config.Incarnation.
+	Incarnation int64
+	// SchemaVersion is the version the metadata is written at, and MinSchemaVersion the oldest version the node reads.
+	// The node reads every version in between, and may read newer ones too.
+	SchemaVersion    byte
+	MinSchemaVersion byte
+	// Breakers summarizes the state of the node's breakers, sorted by name.
+	Breakers []BreakerSummary
+	// Truncated is true if some breakers were left out to fit memberlist's metadata size limit.
+	Truncated bool
+	// PublicKey verifies the node's signed opinions, if it signs them.
+	PublicKey ed25519.PublicKey
+}
+
+// BreakerSummary is a breaker's state as advertised in a node's metadata.
+type BreakerSummary struct {
+	Name  string
+	State gedcb.State
+}
+
+// Participates returns true if the node advertised the named breaker, or if it may have left it out of truncated metadata.
+func (m NodeMeta) Participates(breaker string) bool {
+	return m.Truncated || m.advertises(breaker)
+}
+
+// advertises returns true if the named breaker is listed in the metadata.
+func (m NodeMeta) advertises(breaker string) bool {
+	for _, summary := range m.Breakers {
+		if summary.Name == breaker {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaVersion returns the oldest version able to carry the metadata, so nodes that have not upgraded yet still accept the node.
+func (m NodeMeta) schemaVersion() byte {
+	for _, summary := range m.Breakers {
+		if summary.State == gedcb.RemoteOpen {
+			return remoteOpenSchemaVersion
+		}
+	}
+
+	return incarnationSchemaVersion
+}
+
+// MarshalBinary encodes the metadata with all of its breakers.
+func (m NodeMeta) MarshalBinary() ([]byte, error) {
+	return m.encode(-1)
+}
+
+// encode encodes the metadata, leaving out the breakers that do not fit within limit bytes. A negative limit means no limit.
+func (m NodeMeta) encode(limit int) ([]byte, error) {
+	if m.Incarnation < 0 {
+		return nil, fmt.Errorf("%w: negative incarnation %d", MalformedMessageErr, m.Incarnation)
+	}
+
+	if len(m.PublicKey) > 0 && len(m.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: public key of %d bytes", MalformedMessageErr, len(m.PublicKey))
+	}
+
+	entries := make([][]byte, 0, len(m.Breakers))
+	for _, summary := range m.Breakers {
+		if summary.State < gedcb.Closed || summary.State > gedcb.RemoteOpen || summary.State == gedcb.RemoteOpen && m.SchemaVersion < remoteOpenSchemaVersion {
+			return nil, fmt.Errorf("%w: unknown state %d of %s in version %d", MalformedMessageErr, summary.State, summary.Name, m.SchemaVersion)
+		}
+
+		entry := binary.AppendUvarint(nil, uint64(len(summary.Name)))
+		entry = append(entry, summary.Name...)
+		entries = append(entries, append(entry, byte(summary.State)))
+	}
+
+	buffer := make([]byte, 0, headerSize+1+binary.MaxVarintLen64*3+len(m.Zone)+1+len(m.PublicKey))
+	buffer = append(buffer, metaMessage, m.SchemaVersion, m.MinSchemaVersion)
+	buffer = binary.AppendUvarint(buffer, uint64(len(m.Zone)))
+	buffer = append(buffer, m.Zone...)
+	buffer = binary.AppendUvarint(buffer, uint64(m.Incarnation))
+
+	// drop breakers from the end until the rest fits, since the flags, public key and count precede them.
+	for {
+		size := len(buffer) + 1 + len(m.PublicKey) + binary.MaxVarintLen16
+		for _, entry := range entries {
+			size += len(entry)
+		}
+
+		if limit < 0 || size <= limit || len(entries) == 0 {
+			break
+		}
+
+		entries = entries[:len(entries)-1]
+	}
+
+	flags := byte(0)
+	if m.Truncated || len(entries) < len(m.Breakers) {
+		flags |= metaTruncated
+	}
+
+	if len(m.PublicKey) > 0 {
+		flags |= metaPublicKey
+	}
+
+	buffer = append(buffer, flags)
+	buffer = append(buffer, m.PublicKey...)
+	buffer = binary.AppendUvarint(buffer, uint64(len(entries)))
+	for _, entry := range entries {
+		buffer = append(buffer, entry...)
+	}
+
+	if limit >= 0 && len(buffer) > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceed the limit of %d", MalformedMessageErr, len(buffer), limit)
+	}
+
+	return buffer, nil
+}
+
+// UnmarshalBinary decodes a node's metadata. It returns UnsupportedVersionErr if the node and this package cannot read each other's messages.
+func (m *NodeMeta) UnmarshalBinary(data []byte) error {
+	reader, err := newMessageReader(data, metaMessage)
+	if err != nil {
+		return err
+	}
+
+	decoded := NodeMeta{SchemaVersion: reader.version}
+	decoded.MinSchemaVersion = reader.byte()
+	decoded.Zone = reader.string()
+	decoded.Incarnation = reader.int64()
+
+	flags := reader.byte()
+	if flags&^(metaTruncated|metaPublicKey) != 0 {
+		reader.fail("unknown flags %#x", flags)
+	}
+
+	decoded.Truncated = flags&metaTruncated != 0
+	if flags&metaPublicKey != 0 {
+		decoded.PublicKey = reader.fixed(ed25519.PublicKeySize)
+	}
+
+	count := reader.uvarint()
+	// every entry takes at least two bytes, which bounds the allocation by the message size.
+	if count > uint64(len(reader.data)) {
+		reader.fail("%d entries exceed remaining %d bytes", count, len(reader.data))
+		count = 0
+	}
+
+	decoded.Breakers = make([]BreakerSummary, 0, count)
+	for i := uint64(0); i < count && reader.err == nil; i++ {
+		decoded.Breakers = append(decoded.Breakers, BreakerSummary{Name: reader.string(), State: reader.state()})
+	}
+
+	if err = reader.close(); err != nil {
+		return err
+	}
+
+	if decoded.MinSchemaVersion > SchemaVersion || decoded.MinSchemaVersion > decoded.SchemaVersion {
+		return fmt.Errorf("%w: node reads versions %d to %d", UnsupportedVersionErr, decoded.MinSchemaVersion, decoded.SchemaVersion)
+	}
+
+	*m = decoded
+
+	return nil
+}
+
+// localMeta encodes the local node's metadata within limit bytes, or returns nil if it cannot be encoded.
+func (c *Cluster) localMeta(limit int) []byte {
+	now := time.Now()
+	meta := NodeMeta{
+		Zone:             c.config.Zone,
+		Incarnation:      c.incarnation,
+		MinSchemaVersion: MinSchemaVersion,
+	}
+
+	if c.config.SigningKey != nil {
+		meta.PublicKey = c.config.SigningKey.Public().(ed25519.PublicKey)
+	}
+
+	for _, name := range c.Breakers() {
+		if breaker, found := c.lookupBreaker(name); found {
+			meta.Breakers = append(meta.Breakers, BreakerSummary{Name: name, State: breaker.State(now)})
+		}
+	}
+
+	meta.SchemaVersion = meta.schemaVersion()
+
+	data, err := meta.encode(limit)
+	if err != nil {
+		c.stats.encodingFailures.Add(1)
+		c.config.Logger.Println("failed to encode node metadata", err)
+		return nil
+	}
+
+	return data
+}
+
+// checkMeta returns an error if a node's metadata is malformed or its versions are incompatible with the local node's.
+// Nodes without metadata are accepted.
+func (c *Cluster) checkMeta(node *memberlist.Node) error {
+	if len(node.Meta) == 0 {
+		return nil
+	}
+
+	var meta NodeMeta
+	if err := meta.UnmarshalBinary(node.Meta); err != nil {
+		c.stats.rejectedMembers.Add(1)
+		return err
+	}
+
+	return nil
+}
+
+// applyMeta records a node's metadata. Opinions the node sent in a previous incarnation about breakers it no longer advertises are dropped,
+// so the node only votes on the breakers it participates in.
+func (c *Cluster) applyMeta(node *memberlist.Node) {
+	if node.Name == c.name || len(node.Meta) == 0 {
+		return
+	}
+
+	var meta NodeMeta
+	if err := meta.UnmarshalBinary(node.Meta); err != nil {
+		c.config.Logger.Printf("ignoring metadata of %s: %v\n", node.Name, err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.peerMeta[node.Name] = meta
+
+	for key, opinion := range c.opinions {
+		if key.node != node.Name || opinion.Incarnation >= meta.Incarnation || meta.Participates(key.breaker) {
+			continue
+		}
+
+		delete(c.opinions, key)
+		delete(c.heard, key)
+		delete(c.expired, key)
+
+		if breaker, found := c.breakers[key.breaker]; found {
+			breaker.DeletePeer(key.node)
+		}
+	}
+
+	// tag the node's votes with its zone. Metadata alone does not give the node a vote, so a breaker it advertises but has not sent
+	// an opinion about yet is not counted as Closed.
+	for name, breaker := range c.breakers {
+		key := opinionKey{node: node.Name, breaker: name}
+		if _, voted := c.opinions[key]; voted && !c.expired[key] {
+			breaker.UpdatePeerZone(node.Name, meta.Zone)
+		}
+	}
+
+	// the breakers the node participates in may have changed.
+	c.electProbers(time.Now())
+}
+
+// PeerMeta returns the metadata advertised by a member of the cluster, if known.
+func (c *Cluster) PeerMeta(node string) (NodeMeta, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	meta, found := c.peerMeta[node]
+
+	return meta, found
+}
+
+// refreshMeta periodically advertises the local node's metadata again when it changes, such as when a breaker changes state.
+func (c *Cluster) refreshMeta(ctx context.Context) {
+	defer c.done.Done()
+
+	ticker := time.NewTicker(c.config.MetaInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if bytes.Equal(c.members.LocalNode().Meta, c.localMeta(memberlist.MetaMaxSize)) {
+				continue
+			}
+
+			if err := c.members.UpdateNode(c.config.MetaInterval); err != nil {
+				c.config.Logger.Println("failed to advertise node metadata", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package gossip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMeta() NodeMeta {
+	return NodeMeta{
+		Zone:             "us-east-1a",
+		Incarnation:      1_700_000_000_000_000_000,
+		SchemaVersion:    SchemaVersion,
+		MinSchemaVersion: MinSchemaVersion,
+		Breakers:         []BreakerSummary{{Name: "cache", State: gedcb.Closed}, {Name: "db", State: gedcb.Open}},
+	}
+}
+
+func TestNodeMetaBinary(t *testing.T) {
+	data, err := newTestMeta().MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded NodeMeta
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, newTestMeta(), decoded)
+	require.True(t, decoded.Participates("db"))
+	require.False(t, decoded.Participates("queue"))
+}
+
+func TestNodeMetaTruncated(t *testing.T) {
+	meta := newTestMeta()
+	meta.Breakers = nil
+	for i := 0; i < 20; i++ {
+		meta.Breakers = append(meta.Breakers, BreakerSummary{Name: fmt.Sprintf("%s-%02d", strings.Repeat("b", 60), i)})
+	}
+
+	data, err := meta.encode(memberlist.MetaMaxSize)
+	require.NoError(t, err)
+	require.True(t, len(data) <= memberlist.MetaMaxSize, "%d bytes exceeds the limit", len(data))
+
+	var decoded NodeMeta
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.True(t, decoded.Truncated)
+	require.True(t, len(decoded.Breakers) > 0 && len(decoded.Breakers) < len(meta.Breakers))
+	require.Equal(t, meta.Breakers[:len(decoded.Breakers)], decoded.Breakers)
+	require.True(t, decoded.Participates("queue"), "truncated metadata may leave out any breaker")
+}
+
+func TestNodeMetaIncompatible(t *testing.T) {
+	cases := map[string]struct {
+		schemaVersion, minSchemaVersion byte
+	}{
+		"unreadable":           {SchemaVersion + 1, SchemaVersion + 1},
+		"unreadable by node":   {SchemaVersion, SchemaVersion + 1},
+		"older than supported": {MinSchemaVersion - 1, MinSchemaVersion - 1},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			meta := newTestMeta()
+			meta.SchemaVersion, meta.MinSchemaVersion = c.schemaVersion, c.minSchemaVersion
+
+			data, err := meta.MarshalBinary()
+			require.NoError(t, err)
+
+			var decoded NodeMeta
+			err = decoded.UnmarshalBinary(data)
+			require.True(t, errors.Is(err, UnsupportedVersionErr), "expected %v, got %v", UnsupportedVersionErr, err)
+		})
+	}
+
+	// a newer node that can still read the local node's messages is compatible
+	meta := newTestMeta()
+	meta.MinSchemaVersion = SchemaVersion
+	data, err := meta.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, new(NodeMeta).UnmarshalBinary(data))
+}
+
+func TestNodeMetaSchemaVersion(t *testing.T) {
+	// metadata is written at the oldest version carrying it, so nodes that have not upgraded yet accept the node
+	meta := newTestMeta()
+	require.Equal(t, incarnationSchemaVersion, meta.schemaVersion())
+
+	meta.Breakers = append(meta.Breakers, BreakerSummary{Name: "queue", State: gedcb.RemoteOpen})
+	require.Equal(t, remoteOpenSchemaVersion, meta.schemaVersion())
+
+	meta.SchemaVersion = remoteOpenSchemaVersion
+	data, err := meta.MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded NodeMeta
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, meta, decoded)
+
+	// an older version does not have the RemoteOpen state
+	data[1] = remoteOpenSchemaVersion - 1
+	require.True(t, errors.Is(decoded.UnmarshalBinary(data), MalformedMessageErr))
+
+	meta.SchemaVersion = remoteOpenSchemaVersion - 1
+	_, err = meta.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+}
+
+func TestApplyMetaScopesVoting(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	db, cache := node.Breaker("db"), node.Breaker("cache")
+	for _, breaker := range []string{"db", "cache"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: breaker, Incarnation: 1, Version: 1, State: gedcb.Open}, "test"))
+	}
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "queue", Incarnation: 2, Version: 1, State: gedcb.Open}, "test"))
+
+	// b restarted without the cache breaker
+	meta := newTestMeta()
+	meta.Incarnation = 2
+	meta.Breakers = []BreakerSummary{{Name: "db"}}
+	data, err := meta.MarshalBinary()
+	require.NoError(t, err)
+
+	node.applyMeta(&memberlist.Node{Name: "b", Meta: data})
+
+	stored, found := node.PeerMeta("b")
+	require.True(t, found)
+	require.Equal(t, meta, stored)
+	require.Contains(t, node.opinions, opinionKey{node: "b", breaker: "db"})
+	require.NotContains(t, node.opinions, opinionKey{node: "b", breaker: "cache"})
+	// opinions of the current incarnation are kept until the node advertises the breaker
+	require.Contains(t, node.opinions, opinionKey{node: "b", breaker: "queue"})
+
+	now := time.Now()
+	for i := 0; i <= node.config.Breaker.SoftFailureThreshold; i++ {
+		require.NoError(t, db.Failure(now))
+		require.NoError(t, cache.Failure(now))
+	}
+	require.Equal(t, gedcb.Open, db.State(now))
+	require.Equal(t, gedcb.Suspicion, cache.State(now))
+}
+
+func TestClusterMeta(t *testing.T) {
+	a, b := newTestConfig("a"), newTestConfig("b")
+	a.Zone, b.Zone = "us-east-1a", "us-east-1b"
+	a.MetaInterval, b.MetaInterval = 10*time.Millisecond, 10*time.Millisecond
+
+	nodes := startTestCluster(t, a, b)
+	suspect(t, nodes[0].Breaker("db"), a.Breaker)
+
+	eventually(t, func() bool {
+		meta, found := nodes[1].PeerMeta("a")
+
+		return found && meta.Zone == "us-east-1a" && len(meta.Breakers) == 1 && meta.Breakers[0].State != gedcb.Closed
+	})
+
+	meta, found := nodes[0].PeerMeta("b")
+	require.True(t, found)
+	require.Equal(t, "us-east-1b", meta.Zone)
+	require.Equal(t, nodes[1].incarnation, meta.Incarnation)
+}
+
+// incompatibleDelegate advertises metadata of a node that writes messages the cluster cannot read.
+type incompatibleDelegate struct{}
+
+func (incompatibleDelegate) NodeMeta(int) []byte {
+	meta := newTestMeta()
+	meta.SchemaVersion, meta.MinSchemaVersion = SchemaVersion+1, SchemaVersion+1
+	data, _ := meta.MarshalBinary()
+
+	return data
+}
+
+func (incompatibleDelegate) NotifyMsg([]byte)                {}
+func (incompatibleDelegate) GetBroadcasts(int, int) [][]byte { return nil }
+func (incompatibleDelegate) LocalState(bool) []byte          { return nil }
+func (incompatibleDelegate) MergeRemoteState([]byte, bool)   {}
+
+func TestClusterRejectsIncompatibleNode(t *testing.T) {
+	nodes := startTestCluster(t, newTestConfig("a"))
+
+	config := memberlist.DefaultLocalConfig()
+	config.Name = "future"
+	config.BindAddr = "127.0.0.1"
+	config.BindPort = 0
+	config.LogOutput = io.Discard
+	config.Delegate = incompatibleDelegate{}
+
+	future, err := memberlist.Create(config)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = future.Shutdown()
+	})
+
+	_, _ = future.Join([]string{nodes[0].LocalNode().Address()})
+
+	eventually(t, func() bool {
+		return nodes[0].Stats().RejectedMembers > 0
+	})
+	require.Len(t, nodes[0].Members(), 1)
+}
+
+func TestApplyMetaZones(t *testing.T) {
+	config := newTestConfig("a")
+	config.Breaker.VotingPolicy = gedcb.ZoneQuorum{Zones: 2}
+
+	var reasons []string
+	config.Breaker.OnTransition = func(change gedcb.StateChange) {
+		reasons = append(reasons, change.Reason)
+	}
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	db := node.Breaker("db")
+	for peer, zone := range map[string]string{"b": "us-east-1a", "c": "us-east-1a", "d": "us-east-1b"} {
+		meta := newTestMeta()
+		meta.Zone = zone
+		meta.Breakers = []BreakerSummary{{Name: "db"}}
+		data, err := meta.MarshalBinary()
+		require.NoError(t, err)
+
+		node.applyMeta(&memberlist.Node{Name: peer, Meta: data})
+	}
+
+	for _, peer := range []string{"b", "c"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: peer, Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Suspicion}, "test"))
+	}
+
+	// d only advertises db, which does not give it a vote, so the peers' majority is in a single zone
+	require.NotContains(t, db.Peers(), "d")
+	require.Equal(t, "us-east-1a", db.Peers()["b"].Zone)
+	require.Equal(t, gedcb.Suspicion, suspectState(t, db))
+
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "d", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Suspicion}, "test"))
+	require.Equal(t, gedcb.Open, db.State(time.Now()))
+	require.Contains(t, reasons[len(reasons)-1], "majority in at least 2 zones")
+
+	// breakers created later tag the peers' votes with their zones too, without creating votes for the peers that advertise them
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "cache", Incarnation: 1, Version: 1, State: gedcb.Suspicion}, "test"))
+	cache := node.Breaker("cache")
+	require.Len(t, cache.Peers(), 1)
+	require.Equal(t, "us-east-1a", cache.Peers()["b"].Zone)
+	require.Equal(t, gedcb.Suspicion, suspectState(t, cache))
+
+	// a zone change re-tags the node's existing votes only
+	meta := newTestMeta()
+	meta.Zone = "us-east-1c"
+	meta.Breakers = []BreakerSummary{{Name: "db"}, {Name: "cache"}}
+	data, err := meta.MarshalBinary()
+	require.NoError(t, err)
+
+	node.applyMeta(&memberlist.Node{Name: "c", Meta: data})
+	require.Equal(t, "us-east-1c", db.Peers()["c"].Zone)
+	require.NotContains(t, cache.Peers(), "c")
+}
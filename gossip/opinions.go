@@ -0,0 +1,272 @@
+package gossip
+
+import (
+	"errors"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// queueOpinion records the local node's opinion about the named breaker in the given state under a new version and queues its broadcast.
+func (c *Cluster) queueOpinion(name string, breaker *gedcb.Breaker, state gedcb.State, now time.Time) {
+	opinion := CircuitBreakerBroadcast{
+		Node:        c.name,
+		Breaker:     name,
+		Incarnation: c.incarnation,
+		State:       state,
+		Idle:        !breaker.Active(now),
+		Health:      c.healthScore(),
+		Probe:       probeResult(breaker, state, now),
+	}
+
+	if breaker.Config().ClusterAggregate {
+		counts := breaker.Counts(now)
+		opinion.Counts = &counts
+	}
+
+	if breaker.Config().FailureKeys > 0 {
+		opinion.Failures = &gedcb.DecayedFailures{Timestamp: now, Keys: gossipedFailureKeys(breaker.TopFailures(now))}
+	}
+
+	c.mutex.Lock()
+	opinion.Leaving = c.leaving
+	opinion.Version = c.opinions[opinion.key()].Version + 1
+	err := c.sign(&opinion)
+	if err == nil {
+		c.opinions[opinion.key()] = opinion
+	}
+	c.mutex.Unlock()
+
+	var queued *broadcast
+	if err == nil {
+		queued, err = newBroadcast(opinion)
+	}
+
+	if err != nil {
+		c.stats.encodingFailures.Add(1)
+		c.config.Logger.Println("failed to encode broadcast", err)
+		return
+	}
+
+	// Open opinions jump ahead of the other broadcasts, so peers stop calling a failed dependency as soon as possible.
+	// An Open opinion superseded by a later one is still sent, but peers ignore it as outdated.
+	if opinion.State == gedcb.Open {
+		c.priority.QueueBroadcast(queued)
+	} else {
+		c.queue.QueueBroadcast(queued)
+	}
+}
+
+// healthScore returns the local node's Lifeguard health score, or zero while the cluster is not started.
+func (c *Cluster) healthScore() int {
+	if c.members == nil {
+		return 0
+	}
+
+	return c.members.GetHealthScore()
+}
+
+// healthChanged returns true if the local node's health score changed since its last opinion about the named breaker.
+func (c *Cluster) healthChanged(name string, health int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	opinion, found := c.opinions[opinionKey{node: c.name, breaker: name}]
+
+	return found && opinion.Health != health
+}
+
+// activityChanged returns true if the breaker became idle or active since the local node's last opinion about it.
+func (c *Cluster) activityChanged(name string, breaker *gedcb.Breaker, now time.Time) bool {
+	if breaker.Config().ActivityWindow == 0 {
+		return false
+	}
+
+	idle := !breaker.Active(now)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	opinion, found := c.opinions[opinionKey{node: c.name, breaker: name}]
+
+	return found && opinion.Idle != idle
+}
+
+// applyOpinion stores a peer's opinion if it is newer than the one already known and updates the breaker it names.
+// Duplicated and reordered deliveries are ignored, as are opinions from before a peer's restart.
+// Opinions about breakers the local node does not have yet are kept until the breaker is created.
+// It returns false if the opinion was ignored.
+func (c *Cluster) applyOpinion(opinion CircuitBreakerBroadcast, source string) bool {
+	if opinion.Node == c.name {
+		return false
+	}
+
+	if err := c.verifyOpinion(opinion); err != nil {
+		c.stats.signatureFailures.Add(1)
+		c.config.Logger.Printf("dropping opinion about %s via %s: %v\n", opinion.Breaker, source, err)
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if current, found := c.opinions[opinion.key()]; found && !opinion.newerThan(current) {
+		c.config.Logger.Printf("ignoring outdated state of %s for %s via %s\n", opinion.Breaker, opinion.Node, source)
+		return false
+	}
+
+	c.opinions[opinion.key()] = opinion
+	c.heard[opinion.key()] = time.Now()
+	delete(c.expired, opinion.key())
+
+	if breaker, found := c.breakers[opinion.Breaker]; found {
+		c.config.Logger.Printf("updated state of %s for %s to %v via %s\n", opinion.Breaker, opinion.Node, opinion.State, source)
+		updatePeer(breaker, opinion, c.peerMeta[opinion.Node].Zone)
+
+		// only the elected prober's results are followed, so a member that probed on its own cannot close every peer's breaker.
+		if opinion.Probe && !opinion.Leaving {
+			if c.electedProber(opinion.Node, opinion.Breaker) {
+				breaker.ProbeResult(opinion.State, time.Now())
+			} else {
+				c.config.Logger.Printf("ignoring probe result of %s for %s, which is not its prober\n", opinion.Node, opinion.Breaker)
+			}
+		}
+
+		// a leaving prober hands probing over right away rather than when memberlist notices its leave.
+		if opinion.Leaving {
+			c.electProber(opinion.Breaker, breaker, time.Now())
+		}
+	}
+
+	return true
+}
+
+// forgetNode removes every opinion of a node that left the cluster, so they are no longer shared with peers.
+func (c *Cluster) forgetNode(node string) {
+	c.mutex.Lock()
+	for key := range c.opinions {
+		if key.node == node {
+			delete(c.opinions, key)
+			delete(c.heard, key)
+			delete(c.expired, key)
+		}
+	}
+	delete(c.peerMeta, node)
+	c.mutex.Unlock()
+
+	c.eachBreaker(func(_ string, breaker *gedcb.Breaker) {
+		breaker.DeletePeer(node)
+	})
+}
+
+// localState encodes every known opinion, the local node's own included, for memberlist's push/pull state sync.
+// Expired opinions are left out so that peers do not learn them again.
+func (c *Cluster) localState() []byte {
+	c.mutex.Lock()
+	messages := make([][]byte, 0, len(c.opinions))
+	for key, opinion := range c.opinions {
+		if c.expired[key] {
+			continue
+		}
+
+		// signed opinions are shared as received, so that their signature still covers them.
+		if opinion.received != nil {
+			messages = append(messages, opinion.received)
+			continue
+		}
+
+		message, err := opinion.MarshalBinary()
+		if err != nil {
+			c.stats.encodingFailures.Add(1)
+			continue
+		}
+
+		messages = append(messages, message)
+	}
+	c.mutex.Unlock()
+
+	return encodeMessages(stateMessage, messages)
+}
+
+// decode decodes a received message, counting and logging the messages and opinions it drops.
+func (c *Cluster) decode(data []byte, source string) []CircuitBreakerBroadcast {
+	opinions, skipped, err := decodeMessage(data)
+	if err != nil {
+		c.stats.droppedMessages.Add(1)
+		c.config.Logger.Println("dropping", source, err)
+		return nil
+	}
+
+	if len(skipped) > 0 {
+		c.stats.droppedOpinions.Add(uint64(len(skipped)))
+		c.config.Logger.Println("dropping opinions of", source, errors.Join(skipped...))
+	}
+
+	return opinions
+}
+
+// mergeRemoteState applies the opinions in a peer's push/pull state that are newer than the ones already known.
+// Opinions of nodes that are no longer members are skipped so that they do not come back after a leave.
+func (c *Cluster) mergeRemoteState(data []byte) {
+	opinions := c.decode(data, "remote state")
+	members := c.memberNames()
+
+	for _, opinion := range opinions {
+		if members != nil && !members[opinion.Node] {
+			continue
+		}
+
+		c.applyOpinion(opinion, "push/pull")
+	}
+}
+
+// memberNames returns the set of alive members' names, or nil while the cluster is not started.
+func (c *Cluster) memberNames() map[string]bool {
+	if c.members == nil {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for _, member := range c.members.Members() {
+		names[member.Name] = true
+	}
+
+	return names
+}
+
+// updatePeer applies a peer's opinion to a breaker, tagged with the peer's zone. The opinions of leaving peers no longer vote.
+func updatePeer(breaker *gedcb.Breaker, opinion CircuitBreakerBroadcast, zone string) {
+	if opinion.Leaving {
+		breaker.DeletePeer(opinion.Node)
+		return
+	}
+
+	breaker.UpdatePeerZone(opinion.Node, zone)
+	breaker.UpdatePeerActivity(opinion.Node, !opinion.Idle)
+	breaker.UpdatePeerHealth(opinion.Node, opinion.Health)
+	breaker.UpdatePeer(opinion.Node, opinion.State)
+
+	if opinion.Counts != nil {
+		breaker.UpdatePeerCounts(opinion.Node, *opinion.Counts)
+	}
+
+	if opinion.Failures != nil {
+		breaker.UpdatePeerFailures(opinion.Node, *opinion.Failures)
+	}
+}
+
+// gossipedFailureKeys returns the top failure keys that fit in an opinion, leaving out keys that are too long.
+func gossipedFailureKeys(keys []gedcb.HeavyHitter) []gedcb.HeavyHitter {
+	gossiped := make([]gedcb.HeavyHitter, 0, min(len(keys), maxFailureKeys))
+	for _, key := range keys {
+		if len(gossiped) == maxFailureKeys {
+			break
+		}
+
+		if len(key.Key) <= maxFailureKeyLength {
+			gossiped = append(gossiped, key)
+		}
+	}
+
+	return gossiped
+}
@@ -0,0 +1,197 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOpinionDuplicate(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	opinion := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Suspicion}
+	require.True(t, node.applyOpinion(opinion, "test"))
+	require.False(t, node.applyOpinion(opinion, "test"))
+}
+
+func TestApplyOpinionReordered(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	older := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Suspicion}
+	newer := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 2, State: gedcb.Closed}
+
+	require.True(t, node.applyOpinion(newer, "test"))
+	require.False(t, node.applyOpinion(older, "test"))
+	require.Equal(t, newer, node.opinions[newer.key()])
+}
+
+func TestApplyOpinionRestart(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	beforeRestart := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 42, State: gedcb.Open}
+	afterRestart := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 2, Version: 1, State: gedcb.Closed}
+
+	require.True(t, node.applyOpinion(beforeRestart, "test"))
+	require.True(t, node.applyOpinion(afterRestart, "test"), "a restarted node's versions start over")
+
+	// a late delivery from before the restart does not override the restarted node's opinion
+	beforeRestart.Version++
+	require.False(t, node.applyOpinion(beforeRestart, "test"))
+	require.Equal(t, afterRestart, node.opinions[afterRestart.key()])
+}
+
+func TestQueueOpinionIncarnation(t *testing.T) {
+	config := newTestConfig("a")
+	config.Incarnation = 7
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	messages := (&delegate{cluster: node}).GetBroadcasts(0, 1024)
+	require.Len(t, messages, 0)
+
+	node.Breaker("db")
+	messages = (&delegate{cluster: node}).GetBroadcasts(0, 1024)
+	require.Len(t, messages, 1)
+
+	opinions, err := DecodeMessage(messages[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(7), opinions[0].Incarnation)
+	require.Equal(t, 1, opinions[0].Version)
+
+	restarted, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+	require.True(t, restarted.incarnation > config.Incarnation, "the default incarnation increases across restarts")
+}
+
+func TestApplyOpinionIdle(t *testing.T) {
+	config := newTestConfig("a")
+	config.Breaker.ActivityWindow = time.Minute
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	// b calls the failing instance, while c and d only know about it
+	db := node.Downstream("db-0.db:5432")
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db-0.db:5432", Incarnation: 1, Version: 1, State: gedcb.Suspicion}, "test"))
+	for _, peer := range []string{"c", "d"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: peer, Breaker: "db-0.db:5432", Incarnation: 1, Version: 1, Idle: true}, "test"))
+	}
+
+	require.Equal(t, gedcb.Open, suspectState(t, db))
+	require.Contains(t, db.LastStateChange().Reason, "1 of 1 peers")
+	require.Contains(t, db.LastStateChange().Reason, "ignoring 2 idle peers")
+
+}
+
+func TestQueueOpinionIdle(t *testing.T) {
+	config := newTestConfig("a")
+	config.Breaker.ActivityWindow = time.Minute
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	d := &delegate{cluster: node}
+	breaker := node.Downstream("DB-0.db.:5432")
+	require.Equal(t, []string{"db-0.db:5432"}, node.Breakers())
+
+	opinions, err := DecodeMessage(d.GetBroadcasts(0, 1024)[0])
+	require.NoError(t, err)
+	require.True(t, opinions[0].Idle, "a breaker without traffic is idle")
+
+	now := time.Now()
+	require.NoError(t, breaker.Success(now))
+	require.True(t, node.activityChanged("db-0.db:5432", breaker, now))
+	require.False(t, node.activityChanged("db-0.db:5432", breaker, now.Add(2*time.Minute)))
+}
+
+func TestDownstreamName(t *testing.T) {
+	for address, expected := range map[string]string{
+		"payments-api":        "payments-api",
+		" Payments-API ":      "payments-api",
+		"DB-0.db.:5432":       "db-0.db:5432",
+		"10.0.0.1:8080":       "10.0.0.1:8080",
+		"[2001:DB8::1]:8080":  "[2001:db8::1]:8080",
+		"payments-api.svc:80": "payments-api.svc:80",
+	} {
+		require.Equal(t, expected, DownstreamName(address), address)
+	}
+}
+
+func TestApplyOpinionHealth(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	// the suspicions of unhealthy nodes weigh less than healthy votes
+	db := node.Breaker("db")
+	for _, peer := range []string{"b", "c"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: peer, Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open, Health: 2}, "test"))
+	}
+	for _, peer := range []string{"d"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: peer, Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Closed}, "test"))
+	}
+	require.Equal(t, gedcb.Suspicion, suspectState(t, db))
+
+	// once healthy again, their votes count in full
+	for _, peer := range []string{"b", "c"} {
+		require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: peer, Breaker: "db", Incarnation: 1, Version: 2, State: gedcb.Open}, "test"))
+	}
+	require.Equal(t, gedcb.Open, db.State(time.Now()))
+}
+
+func TestApplyOpinionLeaving(t *testing.T) {
+	node, err := NewCluster(newTestConfig("a"))
+	require.NoError(t, err)
+
+	db := node.Breaker("db")
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}, "test"))
+	require.Contains(t, db.Peers(), "b")
+
+	// a leaving node's vote stops counting right away, and its older opinions are not applied again
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 2, State: gedcb.Open, Leaving: true}, "test"))
+	require.NotContains(t, db.Peers(), "b")
+	require.False(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}, "test"))
+
+	// nor does it count towards breakers created later
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "cache", Incarnation: 1, Version: 1, State: gedcb.Open, Leaving: true}, "test"))
+	require.Empty(t, node.Breaker("cache").Peers())
+
+	// until it rejoins
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 2, Version: 1, State: gedcb.Open}, "test"))
+	require.Contains(t, db.Peers(), "b")
+}
+
+func TestApplyOpinionFailures(t *testing.T) {
+	config := newTestConfig("a")
+	config.Breaker.FailureKeys = 2
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	now := time.Now()
+	db := node.Breaker("db")
+	require.NoError(t, db.Failure(now, "tenant-a"))
+
+	// the local node gossips its top failure keys with its opinion
+	d := &delegate{cluster: node}
+	opinions, err := DecodeMessage(d.GetBroadcasts(0, 1400)[0])
+	require.NoError(t, err)
+	require.NotNil(t, opinions[0].Failures)
+	require.Equal(t, "tenant-a", opinions[0].Failures.Keys[0].Key)
+
+	// and merges the keys of its peers without counting a peer's repeated report twice
+	failures := &gedcb.DecayedFailures{Timestamp: now, Keys: []gedcb.HeavyHitter{{Key: "tenant-b", Count: 3}}}
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, Failures: failures}, "test"))
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 2, Failures: failures}, "test"))
+
+	top := db.ClusterTopFailures(now)
+	require.Len(t, top, 2)
+	require.Equal(t, "tenant-b", top[0].Key)
+	require.InDelta(t, 3, top[0].Count, 1e-9)
+	require.Equal(t, "tenant-a", top[1].Key)
+}
@@ -0,0 +1,134 @@
+package gossip
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// PartitionChange describes the local node losing sight of most of the cluster, or seeing it again once the partition heals.
+type PartitionChange struct {
+	// Partitioned is true while the local node's breakers ignore their peers.
+	Partitioned bool
+	// Members is the number of alive members, the local node included, and Expected the size the cluster is expected to have.
+	Members   int
+	Expected  int
+	Timestamp time.Time
+}
+
+func (p PartitionChange) String() string {
+	if p.Partitioned {
+		return fmt.Sprintf("partitioned with %d of %d expected members, breakers ignore their peers", p.Members, p.Expected)
+	}
+
+	return fmt.Sprintf("partition healed with %d of %d expected members, breakers count their peers", p.Members, p.Expected)
+}
+
+// Partitioned returns true if the local node sees too few members of the cluster for its breakers to trust their peers' majority.
+func (c *Cluster) Partitioned() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.partitioned
+}
+
+// memberJoined counts a node as alive, raising the learned cluster size if needed.
+func (c *Cluster) memberJoined(node *memberlist.Node) {
+	c.mutex.Lock()
+	c.live[node.Name] = true
+	delete(c.failed, node.Name)
+	c.highWater = max(c.highWater, len(c.live))
+	c.electProbers(time.Now())
+	change := c.checkPartition()
+	c.mutex.Unlock()
+
+	c.notifyPartition(change)
+}
+
+// memberLeft stops counting a node as alive. A node that left gracefully, rather than failed, also lowers the learned cluster size,
+// so that scaling the cluster down is not mistaken for a partition. A failed node lowers it once the DeadMemberTimeout passes,
+// see reapFailed. The local node leaving is not a partition either.
+func (c *Cluster) memberLeft(node *memberlist.Node) {
+	if node.Name == c.name {
+		return
+	}
+
+	c.mutex.Lock()
+	if _, failed := c.failed[node.Name]; c.live[node.Name] || failed {
+		delete(c.live, node.Name)
+
+		if node.State == memberlist.StateLeft {
+			delete(c.failed, node.Name)
+			c.highWater = max(c.highWater-1, len(c.live))
+		} else if !failed {
+			c.failed[node.Name] = time.Now()
+		}
+	}
+	c.electProbers(time.Now())
+	change := c.checkPartition()
+	c.mutex.Unlock()
+
+	c.notifyPartition(change)
+}
+
+// reapFailed stops counting the members that failed more than the DeadMemberTimeout ago towards the learned cluster size,
+// as if they had left gracefully.
+func (c *Cluster) reapFailed(now time.Time) {
+	if c.config.DeadMemberTimeout <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	for node, failed := range c.failed {
+		if now.Sub(failed) < c.config.DeadMemberTimeout {
+			continue
+		}
+
+		delete(c.failed, node)
+		c.highWater = max(c.highWater-1, len(c.live))
+	}
+	change := c.checkPartition()
+	c.mutex.Unlock()
+
+	c.notifyPartition(change)
+}
+
+// expectedMembers returns the configured ExpectedMembers, or the learned cluster size. The caller must hold the mutex.
+func (c *Cluster) expectedMembers() int {
+	if c.config.ExpectedMembers > 0 {
+		return c.config.ExpectedMembers
+	}
+
+	return c.highWater
+}
+
+// checkPartition switches the breakers into or out of local-only mode when the fraction of alive members crosses the PartitionThreshold.
+// It returns the change, or nil if there is none. The caller must hold the mutex.
+func (c *Cluster) checkPartition() *PartitionChange {
+	expected := c.expectedMembers()
+	partitioned := c.config.PartitionThreshold > 0 && float64(len(c.live)) <= c.config.PartitionThreshold*float64(expected)
+	if partitioned == c.partitioned {
+		return nil
+	}
+
+	c.partitioned = partitioned
+	for _, breaker := range c.breakers {
+		breaker.SetLocalOnly(partitioned)
+	}
+
+	return &PartitionChange{Partitioned: partitioned, Members: len(c.live), Expected: expected, Timestamp: time.Now()}
+}
+
+// notifyPartition logs a partition change, if any, and calls OnPartition with it.
+func (c *Cluster) notifyPartition(change *PartitionChange) {
+	if change == nil {
+		return
+	}
+
+	c.config.Logger.Println(change)
+
+	if c.config.OnPartition != nil {
+		c.config.OnPartition(*change)
+	}
+}
@@ -0,0 +1,110 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterPartition(t *testing.T) {
+	var changes []PartitionChange
+	config := newTestConfig("a")
+	config.OnPartition = func(change PartitionChange) {
+		changes = append(changes, change)
+	}
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	db := node.Breaker("db")
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		node.memberJoined(&memberlist.Node{Name: name, State: memberlist.StateAlive})
+	}
+	require.Empty(t, changes)
+
+	// a graceful leave shrinks the cluster rather than partitioning it
+	node.memberLeft(&memberlist.Node{Name: "e", State: memberlist.StateLeft})
+	require.False(t, node.Partitioned())
+
+	// losing half of the remaining members is a partition
+	node.memberLeft(&memberlist.Node{Name: "d", State: memberlist.StateDead})
+	require.False(t, node.Partitioned())
+	node.memberLeft(&memberlist.Node{Name: "c", State: memberlist.StateDead})
+	require.True(t, node.Partitioned())
+	require.True(t, db.LocalOnly())
+	require.True(t, node.Breaker("cache").LocalOnly(), "breakers created while partitioned ignore their peers too")
+	require.Equal(t, []PartitionChange{{Partitioned: true, Members: 2, Expected: 4, Timestamp: changes[0].Timestamp}}, changes)
+
+	node.memberJoined(&memberlist.Node{Name: "c", State: memberlist.StateAlive})
+	require.False(t, node.Partitioned())
+	require.False(t, db.LocalOnly())
+	require.Len(t, changes, 2)
+	require.Equal(t, PartitionChange{Members: 3, Expected: 4, Timestamp: changes[1].Timestamp}, changes[1])
+
+	// nor is the local node leaving
+	node.memberLeft(&memberlist.Node{Name: "a", State: memberlist.StateLeft})
+	require.False(t, node.Partitioned())
+	require.Len(t, changes, 2)
+}
+
+func TestClusterPartitionExpectedMembers(t *testing.T) {
+	config := newTestConfig("a")
+	config.ExpectedMembers = 5
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	// a node that cannot see most of the expected cluster does not trust its peers, even on startup
+	node.memberJoined(&memberlist.Node{Name: "a", State: memberlist.StateAlive})
+	node.memberJoined(&memberlist.Node{Name: "b", State: memberlist.StateAlive})
+	require.True(t, node.Partitioned())
+	require.True(t, node.Breaker("db").LocalOnly())
+
+	node.memberJoined(&memberlist.Node{Name: "c", State: memberlist.StateAlive})
+	require.False(t, node.Partitioned())
+
+	// unless partition detection is disabled
+	config.PartitionThreshold = 0
+	node, err = NewCluster(config)
+	require.NoError(t, err)
+
+	node.memberJoined(&memberlist.Node{Name: "a", State: memberlist.StateAlive})
+	require.False(t, node.Partitioned())
+}
+
+func TestClusterPartitionReapsFailedMembers(t *testing.T) {
+	config := newTestConfig("a")
+	config.DeadMemberTimeout = time.Minute
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		node.memberJoined(&memberlist.Node{Name: name, State: memberlist.StateAlive})
+	}
+
+	// c and d crash after their replacements joined, which leaves 4 of 6 members the cluster ever had
+	node.memberJoined(&memberlist.Node{Name: "e", State: memberlist.StateAlive})
+	node.memberJoined(&memberlist.Node{Name: "f", State: memberlist.StateAlive})
+	node.memberLeft(&memberlist.Node{Name: "c", State: memberlist.StateDead})
+	node.memberLeft(&memberlist.Node{Name: "d", State: memberlist.StateDead})
+	require.False(t, node.Partitioned())
+
+	// failed members still count until the timeout, in case they come back
+	node.reapFailed(time.Now().Add(config.DeadMemberTimeout / 2))
+	require.Equal(t, 6, node.expectedMembers())
+
+	node.reapFailed(time.Now().Add(config.DeadMemberTimeout))
+	require.Equal(t, 4, node.expectedMembers())
+
+	// so one more crash is no longer mistaken for a partition
+	node.memberLeft(&memberlist.Node{Name: "b", State: memberlist.StateDead})
+	require.False(t, node.Partitioned())
+
+	// a failed member that comes back is not reaped
+	node.memberJoined(&memberlist.Node{Name: "b", State: memberlist.StateAlive})
+	node.reapFailed(time.Now().Add(config.DeadMemberTimeout))
+	require.Equal(t, 4, node.expectedMembers())
+}
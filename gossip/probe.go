@@ -0,0 +1,95 @@
+package gossip
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// Prober returns the member elected to probe the named breaker's downstream while it is in HalfOpen, or false if the breaker does not exist
+// or does not coordinate its probes, see gedcb.BreakerConfig.ProbeTimeout.
+func (c *Cluster) Prober(name string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	prober, found := c.probers[name]
+
+	return prober, found
+}
+
+// electProbers elects the prober of every breaker that coordinates its probes. The caller must hold the mutex.
+func (c *Cluster) electProbers(now time.Time) {
+	for name, breaker := range c.breakers {
+		c.electProber(name, breaker, now)
+	}
+}
+
+// electProber elects the prober of the named breaker for the current ProbePeriod by rendezvous hashing over the alive members that
+// participate in the breaker and are not leaving, so that every member agrees on it without coordination and a new one is elected
+// as soon as the prober leaves or fails. The caller must hold the mutex.
+func (c *Cluster) electProber(name string, breaker *gedcb.Breaker, now time.Time) {
+	if breaker.Config().ProbeTimeout <= 0 {
+		return
+	}
+
+	var period int64
+	if c.config.ProbePeriod > 0 {
+		period = now.UnixNano() / int64(c.config.ProbePeriod)
+	}
+
+	prober, highest := c.name, rendezvous(c.name, name, period)
+	for node := range c.live {
+		if meta, found := c.peerMeta[node]; node == c.name || (found && !meta.Participates(name)) {
+			continue
+		}
+
+		if opinion, found := c.opinions[opinionKey{node: node, breaker: name}]; found && opinion.Leaving {
+			continue
+		}
+
+		if score := rendezvous(node, name, period); score > highest || (score == highest && node < prober) {
+			prober, highest = node, score
+		}
+	}
+
+	if current, found := c.probers[name]; current != prober {
+		c.config.Logger.Printf("elected %s to probe %s\n", prober, name)
+
+		if found {
+			c.previous[name] = current
+		}
+	}
+
+	c.probers[name] = prober
+	breaker.SetProber(prober == c.name)
+}
+
+// electedProber returns true if the node is the current or previous prober of the named breaker, so that a result the previous prober
+// sent just before another one was elected still counts. The caller must hold the mutex.
+func (c *Cluster) electedProber(node, name string) bool {
+	prober, found := c.probers[name]
+
+	return found && (node == prober || node == c.previous[name])
+}
+
+// rendezvous returns the node's score for probing the named breaker in the given period. The node with the highest score is the prober.
+func rendezvous(node, breaker string, period int64) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(node))
+	hash.Write([]byte{0})
+	hash.Write([]byte(breaker))
+	hash.Write(binary.AppendVarint([]byte{0}, period))
+
+	return hash.Sum64()
+}
+
+// probeResult returns true if the given state is the outcome of the breaker leaving HalfOpen within the ProbeTimeout, so that peers still
+// waiting for the prober follow it. Later opinions in the same state, such as heartbeats, are not probe results.
+func probeResult(breaker *gedcb.Breaker, state gedcb.State, now time.Time) bool {
+	timeout := breaker.Config().ProbeTimeout
+	change := breaker.LastStateChange()
+
+	return timeout > 0 && change.From == gedcb.HalfOpen && change.To == state && now.Sub(change.Timestamp) < timeout
+}
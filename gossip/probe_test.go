@@ -0,0 +1,167 @@
+package gossip
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElectProber(t *testing.T) {
+	members := []string{"a", "b", "c", "d"}
+	nodes := make([]*Cluster, 0, len(members))
+
+	for _, name := range members {
+		config := newTestConfig(name)
+		config.Breaker.ProbeTimeout = 5 * time.Second
+		config.ProbePeriod = 0
+
+		node, err := NewCluster(config)
+		require.NoError(t, err)
+
+		node.Breaker("db")
+		for _, member := range members {
+			node.memberJoined(&memberlist.Node{Name: member, State: memberlist.StateAlive})
+		}
+		nodes = append(nodes, node)
+	}
+
+	// every member elects the same prober without coordination
+	prober, found := nodes[0].Prober("db")
+	require.True(t, found)
+	for _, node := range nodes {
+		elected, _ := node.Prober("db")
+		require.Equal(t, prober, elected)
+	}
+
+	// and another one once the prober fails
+	var survivors []*Cluster
+	for _, node := range nodes {
+		if node.Name() != prober {
+			node.memberLeft(&memberlist.Node{Name: prober, State: memberlist.StateDead})
+			survivors = append(survivors, node)
+		}
+	}
+
+	next, _ := survivors[0].Prober("db")
+	require.NotEqual(t, prober, next)
+	for _, node := range survivors {
+		elected, _ := node.Prober("db")
+		require.Equal(t, next, elected)
+	}
+
+	// breakers the local node does not have have no prober
+	_, found = survivors[0].Prober("cache")
+	require.False(t, found)
+}
+
+func TestReelectProber(t *testing.T) {
+	newNode := func() (*Cluster, string) {
+		config := newTestConfig("a")
+		config.Breaker.ProbeTimeout = 5 * time.Second
+		config.ProbePeriod = 0
+
+		node, err := NewCluster(config)
+		require.NoError(t, err)
+
+		node.Breaker("db")
+		for _, name := range []string{"b", "c", "d", "e"} {
+			node.memberJoined(&memberlist.Node{Name: name, State: memberlist.StateAlive})
+		}
+
+		prober, _ := node.Prober("db")
+		if prober == node.Name() {
+			node.memberLeft(&memberlist.Node{Name: "e", State: memberlist.StateLeft})
+			prober, _ = node.Prober("db")
+		}
+		require.NotEqual(t, node.Name(), prober)
+
+		return node, prober
+	}
+
+	// a leaving prober hands over without waiting for memberlist or the ReconcileInterval
+	node, prober := newNode()
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: prober, Breaker: "db", Incarnation: 1, Version: 1, Leaving: true}, "test"))
+	elected, _ := node.Prober("db")
+	require.NotEqual(t, prober, elected)
+
+	// the results of the previous prober still count, in case it sent them just before the new election, unlike the ones of other members
+	require.True(t, node.electedProber(elected, "db"))
+	require.True(t, node.electedProber(prober, "db"))
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if name != prober && name != elected {
+			require.False(t, node.electedProber(name, "db"), name)
+		}
+	}
+	require.False(t, node.electedProber(prober, "cache"))
+
+	// so does a prober that stops advertising the breaker
+	node, prober = newNode()
+	meta := newTestMeta()
+	meta.Breakers = []BreakerSummary{{Name: "cache"}}
+	data, err := meta.MarshalBinary()
+	require.NoError(t, err)
+
+	node.applyMeta(&memberlist.Node{Name: prober, Meta: data})
+	elected, _ = node.Prober("db")
+	require.NotEqual(t, prober, elected)
+}
+
+func TestApplyOpinionProbe(t *testing.T) {
+	config := newTestConfig("a")
+	config.Breaker.OpenDuration = 10 * time.Millisecond
+	config.Breaker.OpenQuorum = 0.5
+	config.Breaker.ProbeTimeout = time.Minute
+	config.Damping = DampingConfig{}
+	config.ProbePeriod = 0
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	breaker := node.Breaker("db")
+	for _, name := range []string{"b", "c", "d", "e"} {
+		node.memberJoined(&memberlist.Node{Name: name, State: memberlist.StateAlive})
+	}
+
+	prober, _ := node.Prober("db")
+	if prober == node.Name() {
+		node.memberLeft(&memberlist.Node{Name: "e", State: memberlist.StateAlive})
+		prober, _ = node.Prober("db")
+	}
+	require.NotEqual(t, node.Name(), prober)
+
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: prober, Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}, "test"))
+	require.Equal(t, gedcb.Open, breaker.State(time.Now()))
+
+	// the local node leaves probing to the prober
+	time.Sleep(2 * config.Breaker.OpenDuration)
+	require.Equal(t, gedcb.HalfOpen, breaker.State(time.Now()))
+	require.True(t, errors.Is(breaker.Acquire(time.Now()), gedcb.OpenBreakerErr))
+
+	// it ignores the results of members that are not the prober, such as one that timed out and probed on its own
+	d := &delegate{cluster: node}
+	broadcastStates(t, d)
+	other := "b"
+	if prober == other {
+		other = "c"
+	}
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: other, Breaker: "db", Incarnation: 1, Version: 1, Probe: true}, "test"))
+	require.Equal(t, gedcb.HalfOpen, breaker.State(time.Now()))
+	require.True(t, errors.Is(breaker.Acquire(time.Now()), gedcb.OpenBreakerErr))
+
+	// and follows the prober's result, which it spreads as its own
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: prober, Breaker: "db", Incarnation: 1, Version: 2, Probe: true}, "test"))
+	require.Equal(t, gedcb.Closed, breaker.State(time.Now()))
+	require.Equal(t, "peer's probe succeeded", breaker.LastStateChange().Reason)
+
+	messages := d.GetBroadcasts(0, 1400)
+	require.Len(t, messages, 1)
+	opinions, err := DecodeMessage(messages[0])
+	require.NoError(t, err)
+	require.Len(t, opinions, 1)
+	require.Equal(t, gedcb.Closed, opinions[0].State)
+	require.True(t, opinions[0].Probe)
+}
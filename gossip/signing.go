@@ -0,0 +1,145 @@
+package gossip
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// UnsignedOpinionErr is returned when an opinion is not signed but its node's opinions must be.
+var UnsignedOpinionErr = errors.New("unsigned opinion")
+
+// UnknownSignerErr is returned when an opinion is signed by a node whose public key is not known.
+var UnknownSignerErr = errors.New("unknown signer")
+
+// InvalidSignatureErr is returned when an opinion's signature was not made by the key of the node it claims to be from.
+var InvalidSignatureErr = errors.New("invalid signature")
+
+// LoadSigningKey reads a base64 encoded ed25519 private key, or the seed it is derived from, from a file.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%s: signing key of %d bytes", path, len(key))
+	}
+}
+
+// LoadTrust reads the public keys of nodes from a trust file. Each line holds a node's name and its base64 encoded ed25519 public key,
+// separated by white space. Blank lines and lines starting with # are ignored.
+func LoadTrust(path string) (map[string]ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	trust := make(map[string]ed25519.PublicKey)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a node name and a public key", path, i+1)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: public key of %d bytes", path, i+1, len(key))
+		}
+
+		trust[fields[0]] = key
+	}
+
+	return trust, nil
+}
+
+// signedMessage returns the bytes covered by an opinion's signature, which is the opinion encoded without its signature.
+// For a received opinion, they are taken from the received bytes, so that opinions encoded by other versions still verify.
+func (c CircuitBreakerBroadcast) signedMessage() ([]byte, error) {
+	if c.signed != nil {
+		return c.signed, nil
+	}
+
+	c.Signature = nil
+
+	return c.MarshalBinary()
+}
+
+// sign signs the local node's opinion if a SigningKey is configured.
+func (c *Cluster) sign(opinion *CircuitBreakerBroadcast) error {
+	if c.config.SigningKey == nil {
+		return nil
+	}
+
+	message, err := opinion.signedMessage()
+	if err != nil {
+		return err
+	}
+
+	opinion.Signature = ed25519.Sign(c.config.SigningKey, message)
+
+	return nil
+}
+
+// publicKey returns the key that signs a node's opinions. Keys from the trust file take precedence over the ones nodes advertise.
+func (c *Cluster) publicKey(node string) ed25519.PublicKey {
+	if key, found := c.trust[node]; found {
+		return key
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.peerMeta[node].PublicKey
+}
+
+// verifyOpinion checks that a peer's opinion was signed by the node it claims to be from.
+// Unsigned opinions are accepted from nodes without a known key, unless RequireSignatures is set.
+func (c *Cluster) verifyOpinion(opinion CircuitBreakerBroadcast) error {
+	key := c.publicKey(opinion.Node)
+
+	if len(opinion.Signature) == 0 {
+		if key != nil || c.config.RequireSignatures {
+			return fmt.Errorf("%w from %s", UnsignedOpinionErr, opinion.Node)
+		}
+
+		return nil
+	}
+
+	if key == nil {
+		return fmt.Errorf("%w %s", UnknownSignerErr, opinion.Node)
+	}
+
+	message, err := opinion.signedMessage()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, message, opinion.Signature) {
+		return fmt.Errorf("%w from %s", InvalidSignatureErr, opinion.Node)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package gossip
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSigningKey returns a deterministic signing key derived from the given byte.
+func newTestSigningKey(b byte) ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = b
+
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// signTestOpinion signs an opinion with the given key, regardless of the node it claims to be from.
+func signTestOpinion(t *testing.T, opinion CircuitBreakerBroadcast, key ed25519.PrivateKey) CircuitBreakerBroadcast {
+	message, err := opinion.signedMessage()
+	require.NoError(t, err)
+	opinion.Signature = ed25519.Sign(key, message)
+
+	return opinion
+}
+
+func TestCircuitBreakerBroadcastSignatureBinary(t *testing.T) {
+	expected := signTestOpinion(t, newTestBroadcast(), newTestSigningKey(1))
+
+	data, err := expected.MarshalBinary()
+	require.NoError(t, err)
+
+	var actual CircuitBreakerBroadcast
+	require.NoError(t, actual.UnmarshalBinary(data))
+	require.Equal(t, data, actual.received)
+
+	// the signature covers the received bytes without it, which are the sender's encoding of the opinion without it
+	signed, err := expected.signedMessage()
+	require.NoError(t, err)
+	require.Equal(t, signed, actual.signed)
+
+	actual.received, actual.signed = nil, nil
+	require.Equal(t, expected, actual)
+
+	_, err = CircuitBreakerBroadcast{Node: "a", Signature: []byte("short")}.MarshalBinary()
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	err = actual.UnmarshalBinary(data[:len(data)-1])
+	require.True(t, errors.Is(err, MalformedMessageErr))
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	key := newTestSigningKey(1)
+
+	for name, data := range map[string][]byte{"seed": key.Seed(), "private": key} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(data)+"\n"), 0o600))
+
+		loaded, err := LoadSigningKey(path)
+		require.NoError(t, err)
+		require.Equal(t, key, loaded)
+	}
+
+	path := filepath.Join(dir, "short")
+	require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0o600))
+	_, err := LoadSigningKey(path)
+	require.Error(t, err)
+}
+
+func TestLoadTrust(t *testing.T) {
+	dir := t.TempDir()
+	key := newTestSigningKey(1).Public().(ed25519.PublicKey)
+
+	path := filepath.Join(dir, "trust")
+	contents := "# node public-key\n\nb " + base64.StdEncoding.EncodeToString(key) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	trust, err := LoadTrust(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]ed25519.PublicKey{"b": key}, trust)
+
+	for name, contents := range map[string]string{"fields": "b\n", "base64": "b !!!\n", "size": "b YQ==\n"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+		_, err = LoadTrust(path)
+		require.Error(t, err, name)
+	}
+}
+
+func TestVerifyOpinion(t *testing.T) {
+	b := newTestSigningKey(2)
+	path := filepath.Join(t.TempDir(), "trust")
+	require.NoError(t, os.WriteFile(path, []byte("b "+base64.StdEncoding.EncodeToString(b.Public().(ed25519.PublicKey))), 0o600))
+
+	config := newTestConfig("a")
+	config.TrustPath = path
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	opinion := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}
+	cases := map[string]struct {
+		opinion  CircuitBreakerBroadcast
+		expected error
+	}{
+		"signed":         {signTestOpinion(t, opinion, b), nil},
+		"forged":         {signTestOpinion(t, opinion, newTestSigningKey(3)), InvalidSignatureErr},
+		"unsigned":       {opinion, UnsignedOpinionErr},
+		"unknown signer": {signTestOpinion(t, CircuitBreakerBroadcast{Node: "c"}, b), UnknownSignerErr},
+		"unknown node":   {CircuitBreakerBroadcast{Node: "c"}, nil},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := node.verifyOpinion(c.opinion)
+			if c.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, c.expected), "expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+
+	node.config.RequireSignatures = true
+	require.True(t, errors.Is(node.verifyOpinion(CircuitBreakerBroadcast{Node: "c"}), UnsignedOpinionErr))
+
+	require.False(t, node.applyOpinion(cases["forged"].opinion, "test"))
+	require.True(t, node.applyOpinion(cases["signed"].opinion, "test"))
+	require.Equal(t, uint64(1), node.Stats().SignatureFailures)
+}
+
+func TestVerifyReceivedOpinion(t *testing.T) {
+	b := newTestSigningKey(2)
+	path := filepath.Join(t.TempDir(), "trust")
+	require.NoError(t, os.WriteFile(path, []byte("b "+base64.StdEncoding.EncodeToString(b.Public().(ed25519.PublicKey))), 0o600))
+
+	config := newTestConfig("a")
+	config.TrustPath = path
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	// b writes every opinion at the newest version, unlike the local node, and signs what it sends
+	data, err := CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Open}.MarshalBinary()
+	require.NoError(t, err)
+	data[1] = SchemaVersion
+	signature := ed25519.Sign(b, data)
+	// the flags are the last byte of an opinion without counts, health or failures
+	data[len(data)-1] |= hasSignature
+	data = append(data, signature...)
+
+	var opinion CircuitBreakerBroadcast
+	require.NoError(t, opinion.UnmarshalBinary(data))
+	reencoded, err := opinion.MarshalBinary()
+	require.NoError(t, err)
+	require.NotEqual(t, data, reencoded)
+
+	require.NoError(t, node.verifyOpinion(opinion))
+	require.True(t, node.applyOpinion(opinion, "test"))
+
+	// the opinion is shared as received, so the peers it is pushed to verify it too
+	opinions, err := DecodeMessage(node.localState())
+	require.NoError(t, err)
+	require.Len(t, opinions, 1)
+	require.Equal(t, data, opinions[0].received)
+	require.NoError(t, node.verifyOpinion(opinions[0]))
+
+	// tampering with the received bytes breaks the signature
+	data[len(data)-ed25519.SignatureSize-2] = byte(gedcb.Closed)
+	require.NoError(t, opinion.UnmarshalBinary(data))
+	require.True(t, errors.Is(node.verifyOpinion(opinion), InvalidSignatureErr))
+}
+
+func TestClusterSignedOpinions(t *testing.T) {
+	configs := []Config{newTestConfig("a"), newTestConfig("b"), newTestConfig("c")}
+	for i := range configs {
+		configs[i].SigningKey = newTestSigningKey(byte(i + 1))
+		configs[i].RequireSignatures = true
+	}
+
+	nodes := startTestCluster(t, configs...)
+	for _, node := range nodes {
+		node.Breaker("db")
+	}
+
+	eventually(t, func() bool {
+		return hasOpinion(nodes[0], "b", "db") && hasOpinion(nodes[0], "c", "db")
+	})
+
+	// c is a member, but cannot speak for b
+	forged, err := signTestOpinion(t, CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: time.Now().UnixNano(), Version: 1, State: gedcb.Open}, configs[2].SigningKey).MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, nodes[2].members.SendBestEffort(localNode(nodes[0]), forged))
+
+	eventually(t, func() bool {
+		return nodes[0].Stats().SignatureFailures > 0
+	})
+	require.False(t, peerSuspects(nodes[0], "b", "db"))
+
+	// genuine signed opinions still count
+	suspect(t, nodes[1].Breaker("db"), configs[1].Breaker)
+	suspect(t, nodes[2].Breaker("db"), configs[2].Breaker)
+	eventually(t, func() bool {
+		return peerSuspects(nodes[0], "b", "db") && peerSuspects(nodes[0], "c", "db")
+	})
+	require.Equal(t, gedcb.Open, suspectState(t, nodes[0].Breaker("db")))
+}
+
+// localNode returns a copy of the node's membership information, for sending it messages directly.
+func localNode(node *Cluster) *memberlist.Node {
+	local := *node.LocalNode()
+
+	return &local
+}
@@ -0,0 +1,46 @@
+package gossip
+
+import (
+	"sync/atomic"
+)
+
+// Stats are counters of notable gossip events since the cluster was created.
+type Stats struct {
+	// DroppedMessages is the number of received messages that could not be decoded.
+	DroppedMessages uint64
+	// DroppedOpinions is the number of opinions skipped within received batches and states because they could not be decoded.
+	DroppedOpinions uint64
+	// EncodingFailures is the number of local broadcasts that could not be encoded and were not sent.
+	EncodingFailures uint64
+	// RejectedMembers is the number of membership announcements rejected for malformed metadata or incompatible versions.
+	RejectedMembers uint64
+	// SignatureFailures is the number of received opinions dropped because they were unsigned, signed by an unknown node or forged.
+	SignatureFailures uint64
+	// ExpiredOpinions is the number of peer opinions that stopped counting because no newer one was heard within the OpinionTTL.
+	ExpiredOpinions uint64
+	// SuppressedFlaps is the number of local state changes, other than to Open, that were not broadcast immediately because of damping.
+	SuppressedFlaps uint64
+}
+
+// stats holds the counters behind Stats so they can be incremented from memberlist's goroutines.
+type stats struct {
+	droppedMessages   atomic.Uint64
+	droppedOpinions   atomic.Uint64
+	encodingFailures  atomic.Uint64
+	rejectedMembers   atomic.Uint64
+	signatureFailures atomic.Uint64
+	expiredOpinions   atomic.Uint64
+	suppressedFlaps   atomic.Uint64
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		DroppedMessages:   s.droppedMessages.Load(),
+		DroppedOpinions:   s.droppedOpinions.Load(),
+		EncodingFailures:  s.encodingFailures.Load(),
+		RejectedMembers:   s.rejectedMembers.Load(),
+		SignatureFailures: s.signatureFailures.Load(),
+		ExpiredOpinions:   s.expiredOpinions.Load(),
+		SuppressedFlaps:   s.suppressedFlaps.Load(),
+	}
+}
@@ -0,0 +1,158 @@
+package gossip
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// PeerView is a member's opinion about a breaker, as seen by the local node.
+type PeerView struct {
+	Node string
+	Zone string
+	// Local is true for the local node, whose State is the one it last broadcast rather than a vote.
+	Local bool
+	// HasOpinion is false for members that have not shared an opinion about the breaker yet.
+	HasOpinion bool
+	State      gedcb.State
+	// Incarnation and Version identify the opinion, and Age is how long ago it was heard. Age is zero for the local node.
+	Incarnation int64
+	Version     int
+	Age         time.Duration
+	Idle        bool
+	// Health is the member's Lifeguard health score and Weight how much its vote counts, see gedcb.Vote.
+	Health int
+	Weight float64
+	// Expired is true for opinions that were not refreshed within the OpinionTTL.
+	Expired bool
+	// Counted is true if the member's vote counts towards the majority.
+	Counted bool
+}
+
+// BreakerView is the cluster's view of a breaker: the local state, every member's opinion and the peers' majority.
+type BreakerView struct {
+	Breaker         string
+	State           gedcb.State
+	Reason          string
+	VotingPolicy    string
+	MajoritySuspect bool
+	// LocalOnly is true while the breaker ignores its peers, such as during a partition.
+	LocalOnly bool
+	// Prober is the member elected to probe the downstream in HalfOpen, if the breaker coordinates its probes.
+	Prober string
+	Peers  []PeerView
+}
+
+// View returns the cluster's view of the named breaker, listing the alive members sorted by name, or false if the breaker does not exist.
+// Before the cluster starts, it lists the nodes with an opinion about the breaker instead.
+func (c *Cluster) View(name string) (BreakerView, bool) {
+	breaker, found := c.lookupBreaker(name)
+	if !found {
+		return BreakerView{}, false
+	}
+
+	now := time.Now()
+	view := BreakerView{
+		Breaker:         name,
+		State:           breaker.State(now),
+		Reason:          breaker.LastStateChange().Reason,
+		VotingPolicy:    breaker.Config().VotingPolicy.String(),
+		MajoritySuspect: breaker.MajoritySuspect(),
+		LocalOnly:       breaker.LocalOnly(),
+	}
+
+	votes := breaker.Peers()
+	members := c.memberNames()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	view.Prober = c.probers[name]
+	if members == nil {
+		members = map[string]bool{c.name: true}
+		for key := range c.opinions {
+			if key.breaker == name {
+				members[key.node] = true
+			}
+		}
+	}
+
+	for node := range members {
+		peer := PeerView{Node: node, Zone: c.peerMeta[node].Zone, Local: node == c.name}
+		if peer.Local {
+			peer.Zone = c.config.Zone
+		}
+
+		key := opinionKey{node: node, breaker: name}
+		if opinion, found := c.opinions[key]; found {
+			peer.HasOpinion = true
+			peer.State = opinion.State
+			peer.Incarnation = opinion.Incarnation
+			peer.Version = opinion.Version
+			peer.Idle = opinion.Idle
+			peer.Health = opinion.Health
+			peer.Expired = c.expired[key]
+
+			if heard, found := c.heard[key]; found {
+				peer.Age = now.Sub(heard)
+			}
+		}
+
+		if vote, found := votes[node]; found {
+			peer.Weight = vote.Weight()
+			peer.Counted = breaker.Counted(vote)
+		}
+
+		view.Peers = append(view.Peers, peer)
+	}
+
+	sort.Slice(view.Peers, func(i, j int) bool {
+		return view.Peers[i].Node < view.Peers[j].Node
+	})
+
+	return view, true
+}
+
+// WriteTable writes the view as a plain-text summary of the breaker followed by a table with one row per member.
+func (v BreakerView) WriteTable(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "breaker %s is %v (%s)\nmajority suspect: %v (%s)\nlocal only: %v\nprober: %s\n\n", v.Breaker, v.State, v.Reason, v.MajoritySuspect, v.VotingPolicy, v.LocalOnly, v.Prober)
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, err = fmt.Fprintln(table, "NODE\tZONE\tSTATE\tVERSION\tAGE\tHEALTH\tWEIGHT\tCOUNTED")
+	if err != nil {
+		return err
+	}
+
+	for _, peer := range v.Peers {
+		node, state, version, age := peer.Node, "-", "-", "-"
+		if peer.Local {
+			node += " (local)"
+		}
+
+		if peer.HasOpinion {
+			state, version, age = peer.State.String(), fmt.Sprintf("%d.%d", peer.Incarnation, peer.Version), peer.Age.Round(time.Millisecond).String()
+		}
+
+		if peer.Idle {
+			state += " (idle)"
+		}
+
+		if peer.Expired {
+			state += " (expired)"
+		}
+
+		_, err = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%d\t%.2f\t%v\n", node, peer.Zone, state, version, age, peer.Health, peer.Weight, peer.Counted)
+		if err != nil {
+			return err
+		}
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,81 @@
+package gossip
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestView(t *testing.T) {
+	config := newTestConfig("a")
+	config.Zone = "us-east-1a"
+	config.Breaker.MaxPeerHealthScore = 4
+
+	node, err := NewCluster(config)
+	require.NoError(t, err)
+
+	_, found := node.View("db")
+	require.False(t, found)
+
+	node.Breaker("db")
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "b", Breaker: "db", Incarnation: 1, Version: 2, State: gedcb.Open, Health: 1}, "test"))
+	node.expireOpinions(time.Now().Add(node.config.OpinionTTL))
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "c", Breaker: "db", Incarnation: 1, Version: 1, Health: 4}, "test"))
+	require.True(t, node.applyOpinion(CircuitBreakerBroadcast{Node: "d", Breaker: "db", Incarnation: 1, Version: 1, State: gedcb.Suspicion}, "test"))
+
+	view, found := node.View("db")
+	require.True(t, found)
+	require.Equal(t, "db", view.Breaker)
+	require.Equal(t, gedcb.Closed, view.State)
+	require.Equal(t, "simple majority", view.VotingPolicy)
+	require.True(t, view.MajoritySuspect, "d is the only peer that counts")
+
+	require.Len(t, view.Peers, 4)
+	require.Equal(t, PeerView{Node: "a", Zone: "us-east-1a", Local: true}, view.Peers[0])
+
+	b := view.Peers[1]
+	require.Equal(t, "b", b.Node)
+	require.True(t, b.HasOpinion)
+	require.Equal(t, gedcb.Open, b.State)
+	require.Equal(t, 2, b.Version)
+	require.Equal(t, 1, b.Health)
+	require.True(t, b.Expired)
+	require.False(t, b.Counted, "expired opinions do not vote")
+	require.True(t, b.Age >= 0)
+
+	c := view.Peers[2]
+	require.Equal(t, "c", c.Node)
+	require.Equal(t, 0.2, c.Weight)
+	require.False(t, c.Counted, "too unhealthy to vote")
+
+	d := view.Peers[3]
+	require.Equal(t, "d", d.Node)
+	require.Equal(t, 1.0, d.Weight)
+	require.True(t, d.Counted)
+}
+
+func TestViewWriteTable(t *testing.T) {
+	view := BreakerView{
+		Breaker:      "db",
+		State:        gedcb.Open,
+		Reason:       "majority of peers suspect a failure",
+		VotingPolicy: "simple majority",
+		Peers: []PeerView{
+			{Node: "a", Zone: "us-east-1a", Local: true},
+			{Node: "b", HasOpinion: true, State: gedcb.Suspicion, Incarnation: 1, Version: 2, Age: time.Second, Expired: true, Weight: 1},
+		},
+	}
+
+	var table strings.Builder
+	require.NoError(t, view.WriteTable(&table))
+
+	lines := strings.Split(table.String(), "\n")
+	require.Equal(t, "breaker db is Open (majority of peers suspect a failure)", lines[0])
+	require.Equal(t, "majority suspect: false (simple majority)", lines[1])
+	require.Regexp(t, `^NODE\s+ZONE\s+STATE`, lines[5])
+	require.Regexp(t, `^a \(local\)\s+us-east-1a\s+-\s+-\s+-\s+0\s+0.00\s+false$`, lines[6])
+	require.Regexp(t, `^b\s+Suspicion \(expired\)\s+1.2\s+1s\s+0\s+1.00\s+false$`, lines[7])
+}
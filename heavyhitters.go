@@ -0,0 +1,179 @@
+package gedcb
+
+import (
+	"sort"
+	"time"
+)
+
+// HeavyHitter is a key tracked by HeavyHitters along with its decayed count.
+// Error is an upper bound on how much Count over-estimates the true decayed count of the key.
+type HeavyHitter struct {
+	Key   string
+	Count float64
+	Error float64
+}
+
+// DecayedFailures are a breaker's top failure keys with their counts normalized to Timestamp, like DecayedCounts,
+// so that peers can decay them to a common time and merge them.
+type DecayedFailures struct {
+	Timestamp time.Time
+	Keys      []HeavyHitter
+}
+
+// HeavyHitters tracks the approximate top-K keys of a stream using the Space-Saving algorithm with forward-decayed weights.
+// Counters are stored as static weights relative to the decay's landmark and are only normalized when read.
+type HeavyHitters struct {
+	capacity int
+	decay    ForwardDecay
+	counters map[string]*HeavyHitter
+}
+
+// NewHeavyHitters creates a heavy-hitters summary that tracks at most capacity keys.
+func NewHeavyHitters(capacity int, decay ForwardDecay) *HeavyHitters {
+	return &HeavyHitters{
+		capacity: capacity,
+		decay:    decay,
+		counters: make(map[string]*HeavyHitter, capacity),
+	}
+}
+
+// Capacity returns the maximum number of keys tracked by the summary.
+func (h *HeavyHitters) Capacity() int {
+	return h.capacity
+}
+
+// Add records an occurrence of the given key with the item's decayed value.
+// When the summary is full, the key with the smallest count is evicted and its count is inherited as error by the new key.
+func (h *HeavyHitters) Add(key string, item Item) {
+	if h.capacity <= 0 {
+		return
+	}
+
+	weight := h.decay.StaticWeightedValue(item)
+
+	if counter, found := h.counters[key]; found {
+		counter.Count += weight
+		return
+	}
+
+	if len(h.counters) < h.capacity {
+		h.counters[key] = &HeavyHitter{Key: key, Count: weight}
+		return
+	}
+
+	minimum := h.minimum()
+	delete(h.counters, minimum.Key)
+	h.counters[key] = &HeavyHitter{Key: key, Count: minimum.Count + weight, Error: minimum.Count}
+}
+
+// Top returns the tracked keys sorted by decreasing decayed count as of the given timestamp.
+// It also moves the decay's landmark to the timestamp, the same way Breaker.State does.
+func (h *HeavyHitters) Top(timestamp time.Time) []HeavyHitter {
+	h.rescale(timestamp)
+
+	factor := h.decay.NormalizingFactor(timestamp)
+	hitters := make([]HeavyHitter, 0, len(h.counters))
+
+	for _, counter := range h.counters {
+		hitters = append(hitters, HeavyHitter{
+			Key:   counter.Key,
+			Count: counter.Count / factor,
+			Error: counter.Error / factor,
+		})
+	}
+
+	sortHeavyHitters(hitters)
+
+	return hitters
+}
+
+// Merge combines a summary produced by another HeavyHitters's Top at the given timestamp into this one.
+// Keys missing from a full summary are assumed to have that summary's minimum count, as in mergeable Space-Saving summaries.
+func (h *HeavyHitters) Merge(timestamp time.Time, hitters []HeavyHitter) {
+	if h.capacity <= 0 {
+		return
+	}
+
+	h.rescale(timestamp)
+
+	factor := h.decay.NormalizingFactor(timestamp)
+	localMinimum, remoteMinimum := 0.0, 0.0
+
+	if len(h.counters) >= h.capacity {
+		localMinimum = h.minimum().Count
+	}
+
+	if len(hitters) >= h.capacity {
+		remoteMinimum = hitters[0].Count
+		for _, hitter := range hitters {
+			remoteMinimum = min(remoteMinimum, hitter.Count)
+		}
+		remoteMinimum *= factor
+	}
+
+	remote := make(map[string]HeavyHitter, len(hitters))
+	for _, hitter := range hitters {
+		remote[hitter.Key] = HeavyHitter{Key: hitter.Key, Count: hitter.Count * factor, Error: hitter.Error * factor}
+	}
+
+	merged := make([]HeavyHitter, 0, len(h.counters)+len(remote))
+
+	for key, counter := range h.counters {
+		other, found := remote[key]
+		if !found {
+			other = HeavyHitter{Count: remoteMinimum, Error: remoteMinimum}
+		}
+
+		merged = append(merged, HeavyHitter{Key: key, Count: counter.Count + other.Count, Error: counter.Error + other.Error})
+	}
+
+	for key, other := range remote {
+		if _, found := h.counters[key]; found {
+			continue
+		}
+
+		merged = append(merged, HeavyHitter{Key: key, Count: other.Count + localMinimum, Error: other.Error + localMinimum})
+	}
+
+	sortHeavyHitters(merged)
+
+	clear(h.counters)
+	for _, hitter := range merged[:min(len(merged), h.capacity)] {
+		h.counters[hitter.Key] = &hitter
+	}
+}
+
+// rescale moves the decay's landmark to the given timestamp and adjusts the static weights accordingly.
+func (h *HeavyHitters) rescale(timestamp time.Time) {
+	age := h.decay.SetLandmark(timestamp)
+	factor := h.decay.G(age)
+
+	for _, counter := range h.counters {
+		counter.Count /= factor
+		counter.Error /= factor
+	}
+}
+
+// minimum returns the counter with the smallest count.
+func (h *HeavyHitters) minimum() *HeavyHitter {
+	var minimum *HeavyHitter
+
+	for _, counter := range h.counters {
+		if minimum == nil || counter.Count < minimum.Count || (counter.Count == minimum.Count && counter.Key > minimum.Key) {
+			minimum = counter
+		}
+	}
+
+	return minimum
+}
+
+// sortHeavyHitters sorts by decreasing count, breaking ties by key for a stable order.
+func sortHeavyHitters(hitters []HeavyHitter) {
+	sort.Slice(hitters, func(i, j int) bool {
+		if hitters[i].Count == hitters[j].Count {
+			return hitters[i].Key < hitters[j].Key
+		}
+
+		return hitters[i].Count > hitters[j].Count
+	})
+}
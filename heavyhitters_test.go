@@ -0,0 +1,141 @@
+package gedcb
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHeavyHitters(t *testing.T) {
+	landmark := time.Now()
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.1, time.Minute))
+	hitters := NewHeavyHitters(2, decay)
+
+	for i := 0; i < 5; i++ {
+		hitters.Add("GET /users", NewBasicItem(landmark, 1.0))
+	}
+	for i := 0; i < 3; i++ {
+		hitters.Add("GET /orders", NewBasicItem(landmark, 1.0))
+	}
+
+	require.Equal(t, []HeavyHitter{
+		{Key: "GET /users", Count: 5},
+		{Key: "GET /orders", Count: 3},
+	}, hitters.Top(landmark))
+
+	// evicts the smallest counter and inherits its count as error
+	hitters.Add("GET /carts", NewBasicItem(landmark, 1.0))
+
+	require.Equal(t, []HeavyHitter{
+		{Key: "GET /users", Count: 5},
+		{Key: "GET /carts", Count: 4, Error: 3},
+	}, hitters.Top(landmark))
+}
+
+func TestHeavyHittersMerge(t *testing.T) {
+	landmark := time.Now()
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.1, time.Minute))
+	local := NewHeavyHitters(2, decay)
+	remote := NewHeavyHitters(2, decay)
+
+	for i := 0; i < 4; i++ {
+		local.Add("tenant-a", NewBasicItem(landmark, 1.0))
+		remote.Add("tenant-b", NewBasicItem(landmark, 1.0))
+	}
+	local.Add("tenant-c", NewBasicItem(landmark, 1.0))
+	remote.Add("tenant-c", NewBasicItem(landmark, 2.0))
+
+	local.Merge(landmark, remote.Top(landmark))
+
+	require.Equal(t, []HeavyHitter{
+		{Key: "tenant-a", Count: 6, Error: 2},
+		{Key: "tenant-b", Count: 5, Error: 1},
+	}, local.Top(landmark))
+}
+
+func TestHeavyHittersDisabled(t *testing.T) {
+	landmark := time.Now()
+	hitters := NewHeavyHitters(0, NewDecay(landmark, ExponentialDecayFunction(0.1, time.Minute)))
+
+	hitters.Add("key", NewBasicItem(landmark, 1.0))
+	hitters.Merge(landmark, []HeavyHitter{{Key: "key", Count: 1}})
+
+	require.Empty(t, hitters.Top(landmark))
+}
+
+func TestBreakerTopFailures(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{
+		WindowSize:           time.Minute,
+		SoftFailureThreshold: 5,
+		HardFailureThreshold: 50,
+		FailureKeys:          2,
+	}
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize))
+	breaker := NewBreaker(config, decay)
+
+	require.NoError(t, breaker.Failure(landmark, "endpoint:/users", "code:503"))
+	require.NoError(t, breaker.Failure(landmark, "endpoint:/users"))
+	require.NoError(t, breaker.Failure(landmark))
+
+	require.Equal(t, 3, breaker.Failures(landmark))
+	require.Equal(t, []HeavyHitter{
+		{Key: "endpoint:/users", Count: 2},
+		{Key: "code:503", Count: 1},
+	}, breaker.TopFailures(landmark))
+}
+
+func TestBreakerClusterTopFailures(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{WindowSize: time.Minute, SoftFailureThreshold: 5, HardFailureThreshold: 50, FailureKeys: 2}
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+
+	require.NoError(t, breaker.Failure(landmark, "tenant-a"))
+	require.NoError(t, breaker.Failure(landmark, "tenant-b"))
+
+	// a peer reporting the same keys again replaces its previous report rather than adding to it
+	peer := DecayedFailures{Timestamp: landmark, Keys: []HeavyHitter{{Key: "tenant-b", Count: 3}}}
+	breaker.UpdatePeerFailures("b", peer)
+	breaker.UpdatePeerFailures("b", peer)
+
+	expected := []HeavyHitter{{Key: "tenant-b", Count: 4}, {Key: "tenant-a", Count: 1}}
+	require.Equal(t, expected, breaker.ClusterTopFailures(landmark))
+	require.Equal(t, expected, breaker.ClusterTopFailures(landmark))
+
+	// an older report does not replace a newer one
+	breaker.UpdatePeerFailures("b", DecayedFailures{Timestamp: landmark.Add(-time.Second), Keys: []HeavyHitter{{Key: "tenant-c", Count: 9}}})
+	require.Equal(t, expected, breaker.ClusterTopFailures(landmark))
+
+	// the local keys are left alone
+	require.Equal(t, []HeavyHitter{{Key: "tenant-a", Count: 1}, {Key: "tenant-b", Count: 1}}, breaker.TopFailures(landmark))
+
+	breaker.DeletePeer("b")
+	require.Equal(t, breaker.TopFailures(landmark), breaker.ClusterTopFailures(landmark))
+}
+
+func TestBreakerTopFailuresRescale(t *testing.T) {
+	landmark := time.Now()
+	config := BreakerConfig{
+		WindowSize:                time.Minute,
+		SuspicionSuccessThreshold: 1000,
+		SoftFailureThreshold:      1000,
+		HardFailureThreshold:      1000,
+		FailureKeys:               2,
+	}
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+
+	// hours of traffic without reading the top failures must not overflow their static weights
+	now := landmark
+	for ; now.Sub(landmark) < 8*time.Hour; now = now.Add(time.Second) {
+		require.NoError(t, breaker.Success(now))
+		require.NoError(t, breaker.Failure(now, "k"))
+		require.Equal(t, Closed, breaker.State(now))
+	}
+
+	hitters := breaker.TopFailures(now)
+	require.Len(t, hitters, 1)
+	require.Equal(t, "k", hitters[0].Key)
+	require.False(t, math.IsNaN(hitters[0].Count) || math.IsInf(hitters[0].Count, 0), "got count %v", hitters[0].Count)
+	require.InDelta(t, float64(breaker.Failures(now)), hitters[0].Count, 1)
+}
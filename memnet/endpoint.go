@@ -0,0 +1,174 @@
+package memnet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb/phasea"
+)
+
+// packetKind tells which of an endpoint's transports a packet was sent by, so it is received by the same one.
+type packetKind int
+
+const (
+	memberlistPacket packetKind = iota
+	gossipPacket
+)
+
+// packet is a packet in flight.
+type packet struct {
+	kind      packetKind
+	from      net.Addr
+	data      []byte
+	timestamp time.Time
+}
+
+// Endpoint is a node's attachment to a Network. It is both a memberlist.Transport and a phasea.Transport,
+// whose packets are kept apart, and it stops receiving once either is shut down.
+type Endpoint struct {
+	network           *Network
+	addr              *net.TCPAddr
+	memberlistPackets chan *memberlist.Packet
+	gossipPackets     chan phasea.Packet
+	streams           chan net.Conn
+	closed            bool
+	mutex             sync.Mutex
+}
+
+var (
+	_ memberlist.Transport = (*Endpoint)(nil)
+	_ phasea.Transport     = (*Endpoint)(nil)
+)
+
+// Addr returns the endpoint's host:port address.
+func (e *Endpoint) Addr() string {
+	return e.addr.String()
+}
+
+// Send sends a phasea packet to the endpoint at addr.
+func (e *Endpoint) Send(addr string, data []byte) error {
+	if e.isClosed() {
+		return ClosedErr
+	}
+
+	e.network.send(e, addr, data, gossipPacket)
+
+	return nil
+}
+
+// Packets returns the channel of received phasea packets.
+func (e *Endpoint) Packets() <-chan phasea.Packet {
+	return e.gossipPackets
+}
+
+// Close detaches the endpoint from the network and closes the channel of phasea packets.
+func (e *Endpoint) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil
+	}
+
+	// memberlist reads its channels until it is shut down after its transport, so only the phasea channel is closed.
+	e.closed = true
+	close(e.gossipPackets)
+
+	return nil
+}
+
+// FinalAdvertiseAddr advertises the endpoint's address, whatever memberlist is configured with.
+func (e *Endpoint) FinalAdvertiseAddr(string, int) (net.IP, int, error) {
+	return e.addr.IP, e.addr.Port, nil
+}
+
+// WriteTo sends a memberlist packet to the endpoint at addr.
+func (e *Endpoint) WriteTo(b []byte, addr string) (time.Time, error) {
+	if e.isClosed() {
+		return time.Time{}, ClosedErr
+	}
+
+	e.network.send(e, addr, b, memberlistPacket)
+
+	return time.Now(), nil
+}
+
+// PacketCh returns the channel of received memberlist packets.
+func (e *Endpoint) PacketCh() <-chan *memberlist.Packet {
+	return e.memberlistPackets
+}
+
+// DialTimeout opens a stream to the endpoint at addr.
+func (e *Endpoint) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	if e.isClosed() {
+		return nil, ClosedErr
+	}
+
+	return e.network.dial(e, addr, timeout)
+}
+
+// StreamCh returns the channel of streams opened to the endpoint.
+func (e *Endpoint) StreamCh() <-chan net.Conn {
+	return e.streams
+}
+
+// Shutdown closes the endpoint for memberlist.
+func (e *Endpoint) Shutdown() error {
+	return e.Close()
+}
+
+func (e *Endpoint) isClosed() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.closed
+}
+
+// enqueue adds a packet to the channel of the transport that sent it. It returns false if the packet was dropped.
+func (e *Endpoint) enqueue(p *packet) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return false
+	}
+
+	switch p.kind {
+	case memberlistPacket:
+		select {
+		case e.memberlistPackets <- &memberlist.Packet{Buf: p.data, From: p.from, Timestamp: p.timestamp}:
+			return true
+		default:
+			return false
+		}
+	case gossipPacket:
+		select {
+		case e.gossipPackets <- phasea.Packet{From: p.from.String(), Data: p.data, Timestamp: p.timestamp}:
+			return true
+		default:
+			return false
+		}
+	default:
+		panic(fmt.Sprintf("unknown packet kind %d", p.kind))
+	}
+}
+
+// accept adds an incoming stream. It returns false if the endpoint is closed or has too many streams waiting.
+func (e *Endpoint) accept(stream net.Conn) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return false
+	}
+
+	select {
+	case e.streams <- stream:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,247 @@
+// Package memnet simulates a network in memory, so that tests can run many gossiping nodes in one process.
+// Its endpoints implement both memberlist.Transport and phasea.Transport, and the network can delay, drop and duplicate packets
+// or partition endpoints from each other.
+package memnet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb/phasea"
+)
+
+// port is the port of every endpoint's address, which differ by IP address.
+const port = 7946
+
+// packetBufferSize is how many packets an endpoint buffers before dropping new ones, as a full socket buffer would.
+const packetBufferSize = 1024
+
+// UnreachableErr is returned when dialing an address that is closed, unknown or on the other side of a partition.
+var UnreachableErr = errors.New("address unreachable")
+
+// ClosedErr is returned when using a closed endpoint.
+var ClosedErr = errors.New("endpoint closed")
+
+// Config describes the conditions of a Network.
+type Config struct {
+	// Latency delays every packet and the establishment of every stream.
+	Latency time.Duration
+	// Jitter adds a random delay of up to Jitter to Latency, so packets may arrive out of order.
+	Jitter time.Duration
+	// Loss is the probability, between 0 and 1, that a packet is dropped. Streams are reliable.
+	Loss float64
+	// Duplication is the probability, between 0 and 1, that a packet is delivered twice.
+	Duplication float64
+	// Seed seeds the random choices of the network, so a test can replay them.
+	Seed int64
+}
+
+// Stats are counters of the packets sent through a Network.
+type Stats struct {
+	// Delivered is the number of packets handed to their destination, including duplicates.
+	Delivered uint64
+	// Dropped is the number of packets lost, blocked by a partition, sent to an unknown or closed address, or overflowing a buffer.
+	Dropped uint64
+	// Duplicated is the number of packets delivered twice.
+	Duplicated uint64
+}
+
+// Network connects the endpoints created from it. It is safe for concurrent use.
+type Network struct {
+	config     Config
+	random     *rand.Rand
+	endpoints  map[string]*Endpoint
+	partitions map[string]int
+	next       int
+	mutex      sync.Mutex
+
+	delivered  atomic.Uint64
+	dropped    atomic.Uint64
+	duplicated atomic.Uint64
+}
+
+// New creates a network with the given conditions.
+func New(config Config) *Network {
+	return &Network{
+		config:     config,
+		random:     rand.New(rand.NewSource(config.Seed)),
+		endpoints:  make(map[string]*Endpoint),
+		partitions: make(map[string]int),
+	}
+}
+
+// SetConfig changes the conditions of the network for the packets sent from now on.
+func (n *Network) SetConfig(config Config) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.config = config
+}
+
+// NewEndpoint attaches a new endpoint to the network, with an address of its own.
+func (n *Network) NewEndpoint() *Endpoint {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.next++
+
+	addr := &net.TCPAddr{IP: net.IPv4(10, byte(n.next>>16), byte(n.next>>8), byte(n.next)), Port: port}
+	endpoint := &Endpoint{
+		network:           n,
+		addr:              addr,
+		memberlistPackets: make(chan *memberlist.Packet, packetBufferSize),
+		gossipPackets:     make(chan phasea.Packet, packetBufferSize),
+		streams:           make(chan net.Conn, packetBufferSize),
+	}
+
+	n.endpoints[addr.String()] = endpoint
+
+	return endpoint
+}
+
+// Partition splits the network into groups of addresses that can only reach the addresses of their own group.
+// Addresses left out of every group form one more group. It replaces any previous partition.
+func (n *Network) Partition(groups ...[]string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	clear(n.partitions)
+	for i, group := range groups {
+		for _, addr := range group {
+			n.partitions[addr] = i + 1
+		}
+	}
+}
+
+// Heal removes the partition, so every address can reach every other one again.
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// Stats returns counters of the packets sent through the network.
+func (n *Network) Stats() Stats {
+	return Stats{
+		Delivered:  n.delivered.Load(),
+		Dropped:    n.dropped.Load(),
+		Duplicated: n.duplicated.Load(),
+	}
+}
+
+// route returns the endpoint at addr if the sender can reach it. The caller must hold the mutex.
+func (n *Network) route(from, to string) (*Endpoint, bool) {
+	endpoint, found := n.endpoints[to]
+	if !found || n.partitions[from] != n.partitions[to] {
+		return nil, false
+	}
+
+	return endpoint, true
+}
+
+// delay returns a random delay for a packet or stream. The caller must hold the mutex.
+func (n *Network) delay() time.Duration {
+	delay := n.config.Latency
+	if n.config.Jitter > 0 {
+		delay += time.Duration(n.random.Int63n(int64(n.config.Jitter)))
+	}
+
+	return delay
+}
+
+// send delivers a copy of the packet to the endpoint at addr, subject to the network's conditions.
+func (n *Network) send(from *Endpoint, to string, data []byte, kind packetKind) {
+	n.mutex.Lock()
+	endpoint, reachable := n.route(from.addr.String(), to)
+	lost := n.random.Float64() < n.config.Loss
+	copies := 1
+	if n.random.Float64() < n.config.Duplication {
+		copies = 2
+	}
+
+	delays := make([]time.Duration, copies)
+	for i := range delays {
+		delays[i] = n.delay()
+	}
+	n.mutex.Unlock()
+
+	if !reachable || lost {
+		n.dropped.Add(1)
+		return
+	}
+
+	if copies > 1 {
+		n.duplicated.Add(1)
+	}
+
+	for _, delay := range delays {
+		p := &packet{kind: kind, from: from.addr, data: append([]byte(nil), data...)}
+		if delay <= 0 {
+			n.deliver(endpoint, p)
+			continue
+		}
+
+		time.AfterFunc(delay, func() {
+			n.deliver(endpoint, p)
+		})
+	}
+}
+
+// deliver hands a packet to an endpoint, dropping it if the endpoint is closed or its buffer is full.
+func (n *Network) deliver(endpoint *Endpoint, p *packet) {
+	p.timestamp = time.Now()
+
+	if endpoint.enqueue(p) {
+		n.delivered.Add(1)
+	} else {
+		n.dropped.Add(1)
+	}
+}
+
+// dial connects the endpoint to the one at addr with an in-memory stream.
+func (n *Network) dial(from *Endpoint, to string, timeout time.Duration) (net.Conn, error) {
+	n.mutex.Lock()
+	endpoint, reachable := n.route(from.addr.String(), to)
+	delay := n.delay()
+	n.mutex.Unlock()
+
+	if !reachable {
+		return nil, fmt.Errorf("%w: %s", UnreachableErr, to)
+	}
+
+	if timeout > 0 && delay > timeout {
+		time.Sleep(timeout)
+		return nil, fmt.Errorf("%w: %s: dial timed out", UnreachableErr, to)
+	}
+
+	time.Sleep(delay)
+
+	local, remote := net.Pipe()
+	if !endpoint.accept(&conn{Conn: remote, local: endpoint.addr, remote: from.addr}) {
+		_ = local.Close()
+		_ = remote.Close()
+
+		return nil, fmt.Errorf("%w: %s", UnreachableErr, to)
+	}
+
+	return &conn{Conn: local, local: from.addr, remote: endpoint.addr}, nil
+}
+
+// conn is one side of an in-memory stream, reporting the endpoints' addresses.
+type conn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
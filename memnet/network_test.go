@@ -0,0 +1,319 @@
+package memnet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/misalcedo/gedcb"
+	"github.com/misalcedo/gedcb/gossip"
+	"github.com/misalcedo/gedcb/memnet"
+	"github.com/misalcedo/gedcb/phasea"
+	"github.com/stretchr/testify/require"
+)
+
+// eventually fails the test if the condition does not become true within a few seconds.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// suspect records enough failures to move the breaker into Suspicion.
+func suspect(t *testing.T, breaker *gedcb.Breaker) {
+	now := time.Now()
+
+	for i := 0; i <= breaker.Config().SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(now))
+	}
+
+	require.Equal(t, gedcb.Suspicion, breaker.State(now))
+}
+
+// receive returns the next phasea packet received by the endpoint, or fails the test if none arrives in time.
+func receive(t *testing.T, endpoint *memnet.Endpoint) phasea.Packet {
+	t.Helper()
+
+	select {
+	case packet := <-endpoint.Packets():
+		return packet
+	case <-time.After(time.Second):
+		t.Fatal("no packet received")
+		return phasea.Packet{}
+	}
+}
+
+// requireNoPacket fails the test if the endpoint receives a phasea packet shortly.
+func requireNoPacket(t *testing.T, endpoint *memnet.Endpoint) {
+	t.Helper()
+
+	select {
+	case packet := <-endpoint.Packets():
+		t.Fatalf("unexpected packet from %s", packet.From)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestNetworkPackets(t *testing.T) {
+	network := memnet.New(memnet.Config{})
+	a := network.NewEndpoint()
+	b := network.NewEndpoint()
+	require.NotEqual(t, a.Addr(), b.Addr())
+
+	require.NoError(t, a.Send(b.Addr(), []byte("hello")))
+	packet := receive(t, b)
+	require.Equal(t, a.Addr(), packet.From)
+	require.Equal(t, []byte("hello"), packet.Data)
+
+	network.SetConfig(memnet.Config{Loss: 1})
+	require.NoError(t, a.Send(b.Addr(), []byte("lost")))
+	requireNoPacket(t, b)
+
+	network.SetConfig(memnet.Config{Duplication: 1})
+	require.NoError(t, a.Send(b.Addr(), []byte("twice")))
+	require.Equal(t, []byte("twice"), receive(t, b).Data)
+	require.Equal(t, []byte("twice"), receive(t, b).Data)
+
+	network.SetConfig(memnet.Config{})
+	network.Partition([]string{a.Addr()})
+	require.NoError(t, a.Send(b.Addr(), []byte("blocked")))
+	requireNoPacket(t, b)
+
+	network.Heal()
+	require.NoError(t, a.Send(b.Addr(), []byte("healed")))
+	require.Equal(t, []byte("healed"), receive(t, b).Data)
+
+	require.Equal(t, memnet.Stats{Delivered: 4, Dropped: 2, Duplicated: 1}, network.Stats())
+
+	require.NoError(t, b.Close())
+	require.NoError(t, a.Send(b.Addr(), []byte("closed")))
+	require.True(t, errors.Is(b.Send(a.Addr(), nil), memnet.ClosedErr))
+	require.Equal(t, uint64(3), network.Stats().Dropped)
+}
+
+func TestNetworkLatency(t *testing.T) {
+	network := memnet.New(memnet.Config{Latency: 50 * time.Millisecond})
+	a := network.NewEndpoint()
+	b := network.NewEndpoint()
+
+	sent := time.Now()
+	require.NoError(t, a.Send(b.Addr(), []byte("slow")))
+	packet := receive(t, b)
+	require.True(t, packet.Timestamp.Sub(sent) >= 50*time.Millisecond)
+}
+
+func TestNetworkStreams(t *testing.T) {
+	network := memnet.New(memnet.Config{})
+	a := network.NewEndpoint()
+	b := network.NewEndpoint()
+
+	conn, err := a.DialTimeout(b.Addr(), time.Second)
+	require.NoError(t, err)
+	require.Equal(t, b.Addr(), conn.RemoteAddr().String())
+
+	accepted := <-b.StreamCh()
+	require.Equal(t, a.Addr(), accepted.RemoteAddr().String())
+
+	go func() {
+		_, _ = conn.Write([]byte("ping"))
+		_ = conn.Close()
+	}()
+
+	data, err := io.ReadAll(accepted)
+	require.NoError(t, err)
+	require.Equal(t, []byte("ping"), data)
+
+	network.Partition([]string{a.Addr()}, []string{b.Addr()})
+	_, err = a.DialTimeout(b.Addr(), time.Second)
+	require.True(t, errors.Is(err, memnet.UnreachableErr))
+}
+
+// startEngines starts a phasea engine on a new endpoint of the network for each name, gossiping with each other.
+func startEngines(t *testing.T, network *memnet.Network, names ...string) []*phasea.Engine {
+	ctx := context.Background()
+	engines := make([]*phasea.Engine, 0, len(names))
+	var addresses []string
+
+	for _, name := range names {
+		config := phasea.DefaultConfig()
+		config.Name = name
+		config.Transport = network.NewEndpoint()
+		config.Period = 10 * time.Millisecond
+		config.Fanout = 2
+		config.Logger = log.New(io.Discard, "", 0)
+
+		engine, err := phasea.NewEngine(config)
+		require.NoError(t, err)
+
+		engines = append(engines, engine)
+		addresses = append(addresses, engine.Addr())
+	}
+
+	for _, engine := range engines {
+		engine.SetPeers(addresses)
+		require.NoError(t, engine.Start(ctx))
+
+		t.Cleanup(func() {
+			_ = engine.Shutdown(ctx)
+		})
+	}
+
+	return engines
+}
+
+func TestPhaseAOverLossyNetwork(t *testing.T) {
+	network := memnet.New(memnet.Config{Latency: time.Millisecond, Jitter: 5 * time.Millisecond, Loss: 0.2, Duplication: 0.1, Seed: 1})
+	engines := startEngines(t, network, "a", "b", "c", "d", "e")
+
+	for _, engine := range engines {
+		suspect(t, engine.Breaker("db"))
+	}
+
+	// e hears from its suspecting peers despite the lost, duplicated and reordered packets, and opens without reaching its hard failure threshold
+	eventually(t, func() bool {
+		return engines[4].Breaker("db").State(time.Now()) == gedcb.Open
+	})
+}
+
+func TestPhaseAPartitionAgesOutOpinions(t *testing.T) {
+	network := memnet.New(memnet.Config{})
+	engines := startEngines(t, network, "a", "b", "c")
+
+	engines[2].Breaker("db")
+
+	heardFrom := func(engine *phasea.Engine, node string, young bool) bool {
+		for _, opinion := range engine.State() {
+			if opinion.Node == node && opinion.Breaker == "db" {
+				return young == (opinion.Age < phasea.DefaultConfig().AgeLimit)
+			}
+		}
+
+		return false
+	}
+
+	eventually(t, func() bool {
+		return heardFrom(engines[0], "c", true)
+	})
+
+	network.Partition([]string{engines[2].Addr()})
+
+	// a and b no longer hear from c, so its opinion reaches the age limit and stops voting
+	eventually(t, func() bool {
+		return heardFrom(engines[0], "c", false) && heardFrom(engines[1], "c", false)
+	})
+
+	network.Heal()
+
+	eventually(t, func() bool {
+		return heardFrom(engines[0], "c", true)
+	})
+}
+
+// startClusters starts a gossip cluster node on a new endpoint of the network for each name and joins them together.
+// The nodes' configurations can be adjusted with configure, if not nil.
+func startClusters(t *testing.T, network *memnet.Network, configure func(*gossip.Config), names ...string) []*gossip.Cluster {
+	ctx := context.Background()
+	nodes := make([]*gossip.Cluster, 0, len(names))
+
+	for _, name := range names {
+		config := gossip.DefaultConfig()
+		config.Memberlist = memberlist.DefaultLocalConfig()
+		config.Memberlist.Name = name
+		config.Memberlist.Transport = network.NewEndpoint()
+		config.Memberlist.LogOutput = io.Discard
+		config.Memberlist.PushPullInterval = time.Second
+		config.Logger = log.New(io.Discard, "", 0)
+
+		if configure != nil {
+			configure(&config)
+		}
+
+		if len(nodes) > 0 {
+			config.Peers = []string{nodes[0].LocalNode().Address()}
+		}
+
+		node, err := gossip.NewCluster(config)
+		require.NoError(t, err)
+		require.NoError(t, node.Start(ctx))
+		require.NoError(t, node.Join(ctx))
+
+		t.Cleanup(func() {
+			_ = node.Shutdown(ctx)
+		})
+
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		eventually(t, func() bool {
+			return len(node.Members()) == len(nodes)
+		})
+	}
+
+	return nodes
+}
+
+func TestClusterOverNetwork(t *testing.T) {
+	network := memnet.New(memnet.Config{Latency: time.Millisecond, Jitter: 2 * time.Millisecond, Duplication: 0.1, Seed: 1})
+
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, fmt.Sprintf("node-%d", i))
+	}
+
+	nodes := startClusters(t, network, nil, names...)
+
+	for _, node := range nodes {
+		suspect(t, node.Breaker("db"))
+	}
+
+	eventually(t, func() bool {
+		return nodes[4].Breaker("db").State(time.Now()) == gedcb.Open
+	})
+}
+
+func TestClusterPartitionOverNetwork(t *testing.T) {
+	network := memnet.New(memnet.Config{Latency: time.Millisecond, Seed: 1})
+	nodes := startClusters(t, network, func(config *gossip.Config) {
+		config.Memberlist.ProbeInterval = 100 * time.Millisecond
+		config.Memberlist.ProbeTimeout = 50 * time.Millisecond
+		config.Memberlist.SuspicionMult = 1
+	}, "a", "b", "c", "d", "e")
+
+	addresses := make([]string, len(nodes))
+	for i, node := range nodes {
+		addresses[i] = node.LocalNode().Address()
+	}
+
+	// a and b only see two of the five members, so they stop trusting each other's majority, unlike the rest of the cluster
+	network.Partition(addresses[:2], addresses[2:])
+	eventually(t, func() bool {
+		return nodes[0].Partitioned() && nodes[1].Partitioned() && len(nodes[4].Members()) == 3
+	})
+	require.True(t, nodes[0].Breaker("db").LocalOnly())
+	require.False(t, nodes[4].Partitioned())
+
+	// memberlist only reconnects the sides by chance, when it gossips to the members it believes are dead. Instead, b and c push their
+	// state to a, which is the peer they join, until each node has refuted the other side's belief that it is dead.
+	network.Heal()
+	eventually(t, func() bool {
+		for _, node := range nodes[1:3] {
+			require.NoError(t, node.Join(context.Background()))
+		}
+
+		return !nodes[0].Partitioned() && !nodes[1].Partitioned()
+	})
+	require.False(t, nodes[0].Breaker("db").LocalOnly())
+}
@@ -0,0 +1,224 @@
+package phasea
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// Every message starts with a header of the message type followed by the schema version of its body.
+const (
+	headerSize = 2
+
+	// SchemaVersion is the version of the message bodies written by this package.
+	SchemaVersion byte = 1
+	// MinSchemaVersion is the oldest version of the message bodies this package can read.
+	MinSchemaVersion byte = 1
+)
+
+// stateMessage carries part or all of a node's gossip set state. It does not share its type with the gossip package's messages,
+// so a node receiving the other protocol's messages by mistake rejects them.
+const stateMessage byte = 0x41
+
+// countHeaderSize bounds the size of a state message's opinion count.
+const countHeaderSize = binary.MaxVarintLen32
+
+// MalformedMessageErr is returned when a message is truncated, has trailing bytes or contains out of range values.
+var MalformedMessageErr = errors.New("malformed message")
+
+// UnknownMessageTypeErr is returned when a message's type byte is not recognized.
+var UnknownMessageTypeErr = errors.New("unknown message type")
+
+// UnsupportedVersionErr is returned when a message's schema version is outside MinSchemaVersion and SchemaVersion.
+var UnsupportedVersionErr = errors.New("unsupported schema version")
+
+// Opinion is a node's opinion about one of its breakers, as held in a gossip set state.
+// Age is the number of gossip periods since the opinion left the node it is about, which is the source of truth for it.
+type Opinion struct {
+	Node    string
+	Breaker string
+	State   gedcb.State
+	Age     int
+}
+
+// appendOpinion encodes an opinion at the end of the buffer.
+func appendOpinion(buffer []byte, opinion Opinion) ([]byte, error) {
+	if opinion.State < gedcb.Closed || opinion.State > gedcb.RemoteOpen {
+		return nil, fmt.Errorf("%w: unknown state %d", MalformedMessageErr, opinion.State)
+	}
+
+	if opinion.Age < 0 {
+		return nil, fmt.Errorf("%w: negative age %d", MalformedMessageErr, opinion.Age)
+	}
+
+	buffer = binary.AppendUvarint(buffer, uint64(len(opinion.Node)))
+	buffer = append(buffer, opinion.Node...)
+	buffer = binary.AppendUvarint(buffer, uint64(len(opinion.Breaker)))
+	buffer = append(buffer, opinion.Breaker...)
+	buffer = append(buffer, byte(opinion.State))
+
+	return binary.AppendUvarint(buffer, uint64(opinion.Age)), nil
+}
+
+// EncodeState packs opinions into as few state messages of at most limit bytes as possible.
+// Each message stands on its own, so losing one only loses the opinions it carries.
+func EncodeState(opinions []Opinion, limit int) ([][]byte, error) {
+	var messages [][]byte
+	var entries [][]byte
+	size := headerSize + countHeaderSize
+
+	flush := func() {
+		if len(entries) == 0 {
+			return
+		}
+
+		buffer := make([]byte, 0, size)
+		buffer = append(buffer, stateMessage, SchemaVersion)
+		buffer = binary.AppendUvarint(buffer, uint64(len(entries)))
+		for _, entry := range entries {
+			buffer = append(buffer, entry...)
+		}
+
+		messages = append(messages, buffer)
+		entries = entries[:0]
+		size = headerSize + countHeaderSize
+	}
+
+	for _, opinion := range opinions {
+		entry, err := appendOpinion(nil, opinion)
+		if err != nil {
+			return nil, err
+		}
+
+		if headerSize+countHeaderSize+len(entry) > limit {
+			return nil, fmt.Errorf("%w: opinion of %s about %s takes %d bytes, over the limit of %d", MalformedMessageErr, opinion.Node, opinion.Breaker, len(entry), limit)
+		}
+
+		if size+len(entry) > limit {
+			flush()
+		}
+
+		entries = append(entries, entry)
+		size += len(entry)
+	}
+
+	flush()
+
+	return messages, nil
+}
+
+// DecodeState decodes a state message. It rejects the whole message if any opinion is malformed.
+func DecodeState(data []byte) ([]Opinion, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: missing header", MalformedMessageErr)
+	}
+
+	if data[0] != stateMessage {
+		return nil, fmt.Errorf("%w: %d", UnknownMessageTypeErr, data[0])
+	}
+
+	if data[1] < MinSchemaVersion || data[1] > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d", UnsupportedVersionErr, data[1])
+	}
+
+	reader := messageReader{data: data[headerSize:]}
+
+	count := reader.uvarint()
+	// every opinion takes at least four bytes, which bounds the allocation by the message size.
+	if count > uint64(len(reader.data)) {
+		return nil, fmt.Errorf("%w: %d opinions exceed remaining %d bytes", MalformedMessageErr, count, len(reader.data))
+	}
+
+	opinions := make([]Opinion, 0, count)
+	for i := uint64(0); i < count && reader.err == nil; i++ {
+		opinions = append(opinions, Opinion{
+			Node:    reader.string(),
+			Breaker: reader.string(),
+			State:   reader.state(),
+			Age:     reader.int(),
+		})
+	}
+
+	if err := reader.close(); err != nil {
+		return nil, err
+	}
+
+	return opinions, nil
+}
+
+// messageReader decodes the fields of a message body, remembering the first error so callers can check it once at the end.
+type messageReader struct {
+	data []byte
+	err  error
+}
+
+func (r *messageReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", MalformedMessageErr, fmt.Sprintf(format, args...))
+	}
+
+	r.data = nil
+}
+
+func (r *messageReader) uvarint() uint64 {
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("invalid unsigned varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *messageReader) int() int {
+	value := r.uvarint()
+	if value > math.MaxInt32 {
+		r.fail("integer %d overflows", value)
+		return 0
+	}
+
+	return int(value)
+}
+
+func (r *messageReader) string() string {
+	length := r.uvarint()
+	if length > uint64(len(r.data)) {
+		r.fail("length %d exceeds remaining %d bytes", length, len(r.data))
+		return ""
+	}
+
+	value := string(r.data[:length])
+	r.data = r.data[length:]
+
+	return value
+}
+
+func (r *messageReader) state() gedcb.State {
+	if len(r.data) < 1 {
+		r.fail("truncated")
+		return gedcb.Closed
+	}
+
+	state := gedcb.State(r.data[0])
+	r.data = r.data[1:]
+
+	if state > gedcb.RemoteOpen {
+		r.fail("unknown state %d", state)
+	}
+
+	return state
+}
+
+// close returns the first decoding error, or an error if there are unread bytes.
+func (r *messageReader) close() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d trailing bytes", len(r.data))
+	}
+
+	return r.err
+}
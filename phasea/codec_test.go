@@ -0,0 +1,81 @@
+package phasea
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	opinions := []Opinion{
+		{Node: "a", Breaker: "db", State: gedcb.Closed, Age: 0},
+		{Node: "b", Breaker: "db", State: gedcb.Open, Age: 3},
+		{Node: "c", Breaker: "cache", State: gedcb.HalfOpen, Age: 300},
+	}
+
+	messages, err := EncodeState(opinions, 1400)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	decoded, err := DecodeState(messages[0])
+	require.NoError(t, err)
+	require.Equal(t, opinions, decoded)
+}
+
+func TestStateSplitsMessages(t *testing.T) {
+	var opinions []Opinion
+	for i := 0; i < 100; i++ {
+		opinions = append(opinions, Opinion{Node: fmt.Sprintf("node-%d", i), Breaker: "payments:8080", State: gedcb.Suspicion, Age: i})
+	}
+
+	messages, err := EncodeState(opinions, 256)
+	require.NoError(t, err)
+	require.True(t, len(messages) > 1)
+
+	var decoded []Opinion
+	for _, message := range messages {
+		require.True(t, len(message) <= 256)
+
+		part, err := DecodeState(message)
+		require.NoError(t, err)
+
+		decoded = append(decoded, part...)
+	}
+
+	require.Equal(t, opinions, decoded)
+}
+
+func TestStateRejectsOversizedOpinion(t *testing.T) {
+	_, err := EncodeState([]Opinion{{Node: string(make([]byte, 300)), Breaker: "db"}}, 256)
+	require.True(t, errors.Is(err, MalformedMessageErr))
+}
+
+func TestDecodeStateRejectsMalformed(t *testing.T) {
+	messages, err := EncodeState([]Opinion{{Node: "a", Breaker: "db", State: gedcb.Open, Age: 1}}, 1400)
+	require.NoError(t, err)
+
+	message := messages[0]
+
+	_, err = DecodeState(message[:len(message)-1])
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = DecodeState(append(append([]byte(nil), message...), 0))
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = DecodeState(nil)
+	require.True(t, errors.Is(err, MalformedMessageErr))
+
+	_, err = DecodeState([]byte{1, SchemaVersion, 0})
+	require.True(t, errors.Is(err, UnknownMessageTypeErr))
+
+	_, err = DecodeState([]byte{stateMessage, SchemaVersion + 1, 0})
+	require.True(t, errors.Is(err, UnsupportedVersionErr))
+
+	unknownState := append([]byte(nil), message...)
+	unknownState[len(unknownState)-2] = byte(gedcb.RemoteOpen + 1)
+	_, err = DecodeState(unknownState)
+	require.True(t, errors.Is(err, MalformedMessageErr))
+}
@@ -0,0 +1,454 @@
+// Package phasea implements Phase A of the distributed circuit breaker protocol over a pluggable Transport:
+// every period each node ages the opinions it holds, then sends its whole gossip set state to a random fanout of its peers,
+// which keep the younger of the opinions they hold and receive. Opinions that reach the age limit no longer vote.
+// It is an alternative to the memberlist based gossip package, with a fixed gossip set instead of a membership protocol.
+package phasea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+)
+
+// NotStartedErr is returned by operations that require the engine to be started.
+var NotStartedErr = errors.New("engine not started")
+
+// AlreadyStartedErr is returned when starting an engine more than once.
+var AlreadyStartedErr = errors.New("engine already started")
+
+// Config configures an Engine.
+type Config struct {
+	// Name identifies the local node in its opinions. It must be unique within the gossip set.
+	Name string
+	// Transport carries the engine's messages. It is closed on Shutdown.
+	Transport Transport
+	// Peers are the addresses of the other nodes in the gossip set. Every one of them may be picked, even if it stopped responding,
+	// so that a node that comes back is gossiped with again.
+	Peers []string
+	// Period is the time T1 between gossip rounds.
+	Period time.Duration
+	// Fanout is the number of random peers sent the gossip set state every round.
+	Fanout int
+	// AgeLimit is the number of rounds after which an opinion no longer votes, since its node is presumed crashed or partitioned.
+	AgeLimit int
+	// MaxPacketSize is the largest message sent. The state is split across several messages when it does not fit in one.
+	MaxPacketSize int
+	// Breaker configures the breakers created on first use by Engine.Breaker.
+	Breaker gedcb.BreakerConfig
+	// Breakers are created along with the engine, each with its own configuration.
+	Breakers map[string]gedcb.BreakerConfig
+	// Decay describes the breakers' decay function.
+	Decay gedcb.DecaySpec
+	// Logger receives the engine's log messages. Defaults to the standard logger.
+	Logger *log.Logger
+}
+
+// DefaultConfig returns a configuration gossiping five times per second, so that an opinion reaches the age limit after two seconds.
+func DefaultConfig() Config {
+	breaker := gedcb.BreakerConfig{
+		WindowSize:                time.Minute,
+		SuspicionSuccessThreshold: 10,
+		SoftFailureThreshold:      5,
+		HardFailureThreshold:      50,
+		HalfOpenFailureThreshold:  2,
+		HalfOpenSuccessThreshold:  2,
+		OpenDuration:              time.Second * 1,
+		FailureKeys:               10,
+	}
+
+	return Config{
+		Period:        200 * time.Millisecond,
+		Fanout:        3,
+		AgeLimit:      10,
+		MaxPacketSize: 1400,
+		Breaker:       breaker,
+		Decay:         gedcb.ExponentialDecaySpec(0.1, breaker.WindowSize),
+		Logger:        log.Default(),
+	}
+}
+
+// Stats are counters of the engine's messages since it was created.
+type Stats struct {
+	// SentMessages is the number of state messages sent to peers.
+	SentMessages uint64
+	// SendFailures is the number of state messages the transport failed to send.
+	SendFailures uint64
+	// ReceivedMessages is the number of state messages received and applied.
+	ReceivedMessages uint64
+	// DroppedMessages is the number of received messages that could not be decoded.
+	DroppedMessages uint64
+}
+
+// opinionKey identifies a node's opinion about one of its breakers.
+type opinionKey struct {
+	node    string
+	breaker string
+}
+
+// Engine gossips the state of a set of named breakers with a gossip set following Phase A of the protocol.
+type Engine struct {
+	config   Config
+	decay    gedcb.ForwardDecay
+	breakers map[string]*gedcb.Breaker
+	opinions map[opinionKey]Opinion
+	peers    []string
+	random   *rand.Rand
+	mutex    sync.Mutex
+
+	sentMessages     atomic.Uint64
+	sendFailures     atomic.Uint64
+	receivedMessages atomic.Uint64
+	droppedMessages  atomic.Uint64
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// NewEngine creates an engine with the given configuration. Call Start to begin gossiping.
+func NewEngine(config Config) (*Engine, error) {
+	if config.Transport == nil {
+		return nil, errors.New("missing transport")
+	}
+
+	if config.Name == "" {
+		return nil, errors.New("missing node name")
+	}
+
+	if config.Period <= 0 || config.Fanout <= 0 || config.AgeLimit <= 0 {
+		return nil, fmt.Errorf("period %v, fanout %d and age limit %d must be positive", config.Period, config.Fanout, config.AgeLimit)
+	}
+
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = DefaultConfig().MaxPacketSize
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+
+	decay, err := gedcb.NewDecayFromSpec(time.Now(), config.Decay)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &Engine{
+		config:   config,
+		decay:    decay,
+		breakers: make(map[string]*gedcb.Breaker),
+		opinions: make(map[opinionKey]Opinion),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	engine.setPeers(config.Peers)
+
+	for name, breakerConfig := range config.Breakers {
+		engine.newBreaker(name, breakerConfig)
+	}
+
+	return engine, nil
+}
+
+// Name returns the name of the local node.
+func (e *Engine) Name() string {
+	return e.config.Name
+}
+
+// Addr returns the address peers send the local node's messages to.
+func (e *Engine) Addr() string {
+	return e.config.Transport.Addr()
+}
+
+// Breaker returns the named breaker, creating it with the configured Breaker if it does not exist yet.
+// The breaker's state is shared with the gossip set.
+func (e *Engine) Breaker(name string) *gedcb.Breaker {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if breaker, found := e.breakers[name]; found {
+		return breaker
+	}
+
+	return e.newBreaker(name, e.config.Breaker)
+}
+
+// Breakers returns the sorted names of the breakers managed by the engine.
+func (e *Engine) Breakers() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	names := make([]string, 0, len(e.breakers))
+	for name := range e.breakers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// newBreaker creates a breaker voting with the young opinions already held about it. The caller must hold the mutex.
+func (e *Engine) newBreaker(name string, config gedcb.BreakerConfig) *gedcb.Breaker {
+	decay := e.decay
+	decay.SetLandmark(time.Now())
+
+	breaker := gedcb.NewBreaker(config, decay)
+	e.breakers[name] = breaker
+
+	for key, opinion := range e.opinions {
+		if key.breaker == name && opinion.Age < e.config.AgeLimit {
+			breaker.UpdatePeer(key.node, opinion.State)
+		}
+	}
+
+	return breaker
+}
+
+// SetPeers replaces the addresses of the gossip set. Opinions are kept, and age out if their nodes left.
+func (e *Engine) SetPeers(peers []string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.setPeers(peers)
+}
+
+// setPeers stores the peers' addresses, leaving out the local node's. The caller must hold the mutex.
+func (e *Engine) setPeers(peers []string) {
+	self := e.config.Transport.Addr()
+
+	e.peers = make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if peer != self {
+			e.peers = append(e.peers, peer)
+		}
+	}
+}
+
+// State returns the gossip set state: the local node's opinions, which are always zero rounds old, followed by the ones held about its peers,
+// sorted by node and breaker.
+func (e *Engine) State() []Opinion {
+	now := time.Now()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.state(now)
+}
+
+// state returns the gossip set state. The caller must hold the mutex.
+func (e *Engine) state(now time.Time) []Opinion {
+	state := make([]Opinion, 0, len(e.breakers)+len(e.opinions))
+	for name, breaker := range e.breakers {
+		state = append(state, Opinion{Node: e.config.Name, Breaker: name, State: breaker.State(now)})
+	}
+
+	for _, opinion := range e.opinions {
+		state = append(state, opinion)
+	}
+
+	sort.Slice(state, func(i, j int) bool {
+		if state[i].Node != state[j].Node {
+			return state[i].Node < state[j].Node
+		}
+
+		return state[i].Breaker < state[j].Breaker
+	})
+
+	return state
+}
+
+// Stats returns counters of the engine's messages.
+func (e *Engine) Stats() Stats {
+	return Stats{
+		SentMessages:     e.sentMessages.Load(),
+		SendFailures:     e.sendFailures.Load(),
+		ReceivedMessages: e.receivedMessages.Load(),
+		DroppedMessages:  e.droppedMessages.Load(),
+	}
+}
+
+// Start begins gossiping every Period and applying the messages received from peers.
+// Background work stops when the context is done or on Shutdown.
+func (e *Engine) Start(ctx context.Context) error {
+	if e.cancel != nil {
+		return AlreadyStartedErr
+	}
+
+	ctx, e.cancel = context.WithCancel(ctx)
+
+	e.done.Add(2)
+	go e.gossip(ctx)
+	go e.receive(ctx)
+
+	return nil
+}
+
+// Shutdown stops gossiping, waits for background work to stop or the context to be done, then closes the transport.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	if e.cancel == nil {
+		return NotStartedErr
+	}
+
+	e.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		e.done.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-stopped:
+	}
+
+	return e.config.Transport.Close()
+}
+
+// gossip runs a round every Period.
+func (e *Engine) gossip(ctx context.Context) {
+	defer e.done.Done()
+
+	ticker := time.NewTicker(e.config.Period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.round(time.Now())
+		}
+	}
+}
+
+// round ages the peers' opinions, then sends the gossip set state to a random fanout of the gossip set.
+func (e *Engine) round(now time.Time) {
+	e.mutex.Lock()
+	e.age()
+	state := e.state(now)
+	targets := e.pickPeers()
+	e.mutex.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	messages, err := EncodeState(state, e.config.MaxPacketSize)
+	if err != nil {
+		e.config.Logger.Println("failed to encode gossip set state", err)
+		return
+	}
+
+	for _, target := range targets {
+		for _, message := range messages {
+			if err := e.config.Transport.Send(target, message); err != nil {
+				e.sendFailures.Add(1)
+				continue
+			}
+
+			e.sentMessages.Add(1)
+		}
+	}
+}
+
+// age increments the age of every opinion held about a peer, up to the age limit. Opinions reaching the limit stop voting.
+// The caller must hold the mutex.
+func (e *Engine) age() {
+	for key, opinion := range e.opinions {
+		if opinion.Age >= e.config.AgeLimit {
+			continue
+		}
+
+		opinion.Age++
+		e.opinions[key] = opinion
+
+		if opinion.Age < e.config.AgeLimit {
+			continue
+		}
+
+		if breaker, found := e.breakers[key.breaker]; found {
+			breaker.DeletePeer(key.node)
+		}
+	}
+}
+
+// pickPeers returns up to Fanout distinct random peers. The caller must hold the mutex.
+func (e *Engine) pickPeers() []string {
+	count := min(e.config.Fanout, len(e.peers))
+	targets := make([]string, 0, count)
+
+	for _, i := range e.random.Perm(len(e.peers))[:count] {
+		targets = append(targets, e.peers[i])
+	}
+
+	return targets
+}
+
+// receive applies the messages received from peers until the context is done or the transport is closed.
+func (e *Engine) receive(ctx context.Context) {
+	defer e.done.Done()
+
+	packets := e.config.Transport.Packets()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
+
+			opinions, err := DecodeState(packet.Data)
+			if err != nil {
+				e.droppedMessages.Add(1)
+				e.config.Logger.Printf("dropping message from %s: %v\n", packet.From, err)
+				continue
+			}
+
+			e.receivedMessages.Add(1)
+			e.apply(opinions)
+		}
+	}
+}
+
+// apply updates the gossip set state with the received opinions that are younger than the ones held.
+// Opinions about the local node are ignored since it is their source of truth.
+func (e *Engine) apply(opinions []Opinion) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, opinion := range opinions {
+		if opinion.Node == e.config.Name {
+			continue
+		}
+
+		opinion.Age = min(opinion.Age, e.config.AgeLimit)
+
+		key := opinionKey{node: opinion.Node, breaker: opinion.Breaker}
+		if held, found := e.opinions[key]; found && held.Age <= opinion.Age {
+			continue
+		}
+
+		e.opinions[key] = opinion
+
+		breaker, found := e.breakers[key.breaker]
+		if !found {
+			continue
+		}
+
+		if opinion.Age < e.config.AgeLimit {
+			breaker.UpdatePeer(key.node, opinion.State)
+		} else {
+			breaker.DeletePeer(key.node)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package phasea
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/misalcedo/gedcb"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTransport records the packets sent through it and never receives any.
+type recordingTransport struct {
+	sent    map[string]int
+	packets chan Packet
+	mutex   sync.Mutex
+}
+
+func newRecordingTransport() *recordingTransport {
+	return &recordingTransport{sent: make(map[string]int), packets: make(chan Packet)}
+}
+
+func (t *recordingTransport) Addr() string {
+	return "self"
+}
+
+func (t *recordingTransport) Send(addr string, data []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.sent[addr]++
+
+	return nil
+}
+
+func (t *recordingTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *recordingTransport) Close() error {
+	return nil
+}
+
+// newTestConfig returns a configuration for a node gossiping every few milliseconds.
+func newTestConfig(name string, transport Transport) Config {
+	config := DefaultConfig()
+	config.Name = name
+	config.Transport = transport
+	config.Period = 10 * time.Millisecond
+	config.Logger = log.New(io.Discard, "", 0)
+
+	return config
+}
+
+// suspect records enough failures to move the breaker into Suspicion.
+func suspect(t *testing.T, breaker *gedcb.Breaker, config gedcb.BreakerConfig) {
+	now := time.Now()
+
+	for i := 0; i <= config.SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(now))
+	}
+
+	require.Equal(t, gedcb.Suspicion, breaker.State(now))
+}
+
+// eventually fails the test if the condition does not become true within a few seconds.
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before the deadline")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEngineMajoritySuspect(t *testing.T) {
+	ctx := context.Background()
+	engines := make([]*Engine, 0, 3)
+	var addresses []string
+
+	for _, name := range []string{"a", "b", "c"} {
+		transport, err := NewUDPTransport("127.0.0.1:0")
+		require.NoError(t, err)
+
+		engine, err := NewEngine(newTestConfig(name, transport))
+		require.NoError(t, err)
+
+		engines = append(engines, engine)
+		addresses = append(addresses, engine.Addr())
+	}
+
+	for _, engine := range engines {
+		engine.SetPeers(addresses)
+		require.NoError(t, engine.Start(ctx))
+
+		t.Cleanup(func() {
+			require.NoError(t, engine.Shutdown(ctx))
+		})
+	}
+
+	config := engines[0].config.Breaker
+	for _, engine := range engines {
+		suspect(t, engine.Breaker("db"), config)
+	}
+
+	// the majority of c's peers suspect a failure, so it opens without reaching its hard failure threshold
+	eventually(t, func() bool {
+		return engines[2].Breaker("db").State(time.Now()) == gedcb.Open
+	})
+}
+
+func TestEngineKeepsYoungerOpinions(t *testing.T) {
+	engine, err := NewEngine(newTestConfig("a", newRecordingTransport()))
+	require.NoError(t, err)
+
+	engine.apply([]Opinion{{Node: "b", Breaker: "db", State: gedcb.Open, Age: 3}})
+	engine.apply([]Opinion{{Node: "b", Breaker: "db", State: gedcb.Closed, Age: 5}})
+	engine.apply([]Opinion{{Node: "a", Breaker: "db", State: gedcb.Open, Age: 0}})
+	require.Equal(t, []Opinion{{Node: "b", Breaker: "db", State: gedcb.Open, Age: 3}}, engine.State())
+
+	engine.apply([]Opinion{{Node: "b", Breaker: "db", State: gedcb.Closed, Age: 1}})
+	require.Equal(t, []Opinion{{Node: "b", Breaker: "db", State: gedcb.Closed, Age: 1}}, engine.State())
+}
+
+func TestEngineAgeLimit(t *testing.T) {
+	engine, err := NewEngine(newTestConfig("a", newRecordingTransport()))
+	require.NoError(t, err)
+
+	config := engine.config.Breaker
+	breaker := engine.Breaker("db")
+
+	engine.apply([]Opinion{{Node: "b", Breaker: "db", State: gedcb.Open, Age: 0}})
+
+	for i := 0; i < engine.config.AgeLimit+2; i++ {
+		engine.round(time.Now())
+	}
+
+	// the age stops increasing at the limit, and b's opinion no longer votes
+	require.Contains(t, engine.State(), Opinion{Node: "b", Breaker: "db", State: gedcb.Open, Age: engine.config.AgeLimit})
+	suspect(t, breaker, config)
+
+	// a fresh opinion from b votes again
+	engine.apply([]Opinion{{Node: "b", Breaker: "db", State: gedcb.Open, Age: 1}})
+	require.Equal(t, gedcb.Open, breaker.State(time.Now()))
+}
+
+func TestEngineFanout(t *testing.T) {
+	transport := newRecordingTransport()
+	config := newTestConfig("a", transport)
+	config.Fanout = 2
+	config.Peers = []string{"self", "b", "c", "d", "e"}
+
+	engine, err := NewEngine(config)
+	require.NoError(t, err)
+
+	engine.Breaker("db")
+
+	for i := 0; i < 50; i++ {
+		engine.round(time.Now())
+	}
+
+	total := 0
+	for peer, sent := range transport.sent {
+		require.NotEqual(t, "self", peer)
+		total += sent
+	}
+
+	// every peer, including the ones that never answer, is picked in turn
+	require.Len(t, transport.sent, 4)
+	require.Equal(t, 100, total)
+	require.Equal(t, uint64(100), engine.Stats().SentMessages)
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewEngine(newTestConfig("a", nil))
+	require.Error(t, err)
+
+	engine, err := NewEngine(newTestConfig("a", newRecordingTransport()))
+	require.NoError(t, err)
+	require.Equal(t, NotStartedErr, engine.Shutdown(ctx))
+	require.NoError(t, engine.Start(ctx))
+	require.Equal(t, AlreadyStartedErr, engine.Start(ctx))
+	require.NoError(t, engine.Shutdown(ctx))
+}
@@ -0,0 +1,133 @@
+package phasea
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxDatagramSize is the largest payload of a UDP datagram over IPv4.
+const maxDatagramSize = 65507
+
+// packetBufferSize is how many received packets a UDPTransport buffers before dropping new ones.
+const packetBufferSize = 256
+
+// PacketTooLargeErr is returned when sending a packet larger than the transport can carry.
+var PacketTooLargeErr = errors.New("packet too large")
+
+// Packet is a message received from a peer.
+type Packet struct {
+	// From is the address of the sender.
+	From string
+	// Data is the message, owned by the receiver.
+	Data []byte
+	// Timestamp is when the packet was received.
+	Timestamp time.Time
+}
+
+// Transport sends and receives unreliable, unordered packets between the members of a gossip set, such as UDP datagrams.
+// Implementations must be safe for concurrent use.
+type Transport interface {
+	// Addr returns the address peers send packets to.
+	Addr() string
+	// Send sends a packet to the given address. Delivery is best effort.
+	Send(addr string, data []byte) error
+	// Packets returns the channel of received packets, which is closed when the transport is closed.
+	Packets() <-chan Packet
+	// Close stops receiving packets and releases the transport's resources.
+	Close() error
+}
+
+// UDPTransport is a Transport sending each packet as a UDP datagram.
+type UDPTransport struct {
+	conn    *net.UDPConn
+	packets chan Packet
+	done    sync.WaitGroup
+	once    sync.Once
+}
+
+// NewUDPTransport listens for packets on a host:port address. Port 0 picks a free port, see Addr.
+func NewUDPTransport(address string) (*UDPTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &UDPTransport{
+		conn:    conn,
+		packets: make(chan Packet, packetBufferSize),
+	}
+
+	transport.done.Add(1)
+	go transport.receive()
+
+	return transport, nil
+}
+
+func (t *UDPTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *UDPTransport) Send(addr string, data []byte) error {
+	if len(data) > maxDatagramSize {
+		return PacketTooLargeErr
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.conn.WriteToUDP(data, udpAddr)
+
+	return err
+}
+
+func (t *UDPTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *UDPTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.conn.Close()
+		t.done.Wait()
+	})
+
+	return err
+}
+
+// receive reads datagrams until the connection is closed. Packets are dropped while the buffer is full, as the network would.
+func (t *UDPTransport) receive() {
+	defer t.done.Done()
+	defer close(t.packets)
+
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, from, err := t.conn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		if err != nil {
+			continue
+		}
+
+		packet := Packet{
+			From:      from.String(),
+			Data:      append([]byte(nil), buffer[:n]...),
+			Timestamp: time.Now(),
+		}
+
+		select {
+		case t.packets <- packet:
+		default:
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package gedcb
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the decay functions in the default registry.
+const (
+	ExponentialDecay        = "exponential"
+	SlidingExponentialDecay = "sliding-exponential"
+	LinearDecay             = "linear"
+	ShiftedPolynomialDecay  = "shifted-polynomial"
+	StepDecay               = "step"
+	NoDecay                 = "none"
+)
+
+// UnknownDecayFunctionErr is returned when a spec names a decay function that is not registered.
+var UnknownDecayFunctionErr = errors.New("unknown decay function")
+
+// InvalidDecaySpecErr is returned when a spec's parameters are missing or out of range.
+var InvalidDecaySpecErr = errors.New("invalid decay spec")
+
+// DuplicateDecayFunctionErr is returned when registering a decay function under a name that is already taken.
+var DuplicateDecayFunctionErr = errors.New("duplicate decay function")
+
+// DecaySpec describes a decay function by name and parameters, so that a decay policy can be configured, gossiped, compared and logged.
+// Durations are expressed in seconds.
+type DecaySpec struct {
+	Name   string             `json:"name"`
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// DecayFactory builds a decay function from the parameters of a spec. It returns an error if the parameters are invalid.
+type DecayFactory func(params map[string]float64) (G, error)
+
+// DecayRegistry maps decay function names to the factories that build them.
+// It is safe for concurrent use.
+type DecayRegistry struct {
+	factories map[string]DecayFactory
+	mutex     sync.RWMutex
+}
+
+// DefaultDecayRegistry is the registry used by NewDecayFromSpec and RegisterDecayFunction.
+var DefaultDecayRegistry = NewDecayRegistry()
+
+// NewDecayRegistry creates a registry containing the built-in decay functions.
+func NewDecayRegistry() *DecayRegistry {
+	return &DecayRegistry{
+		factories: map[string]DecayFactory{
+			ExponentialDecay:        exponentialDecayFactory,
+			SlidingExponentialDecay: slidingExponentialDecayFactory,
+			LinearDecay:             linearDecayFactory,
+			ShiftedPolynomialDecay:  shiftedPolynomialDecayFactory,
+			StepDecay:               stepDecayFactory,
+			NoDecay:                 noDecayFactory,
+		},
+	}
+}
+
+// Register adds a decay function to the registry. It returns an error if the name is already registered.
+func (r *DecayRegistry) Register(name string, factory DecayFactory) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.factories[name]; found {
+		return fmt.Errorf("%w: %s", DuplicateDecayFunctionErr, name)
+	}
+
+	r.factories[name] = factory
+
+	return nil
+}
+
+// Names returns the sorted names of the registered decay functions.
+func (r *DecayRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return sortedKeys(r.factories)
+}
+
+// Build validates the spec and returns the decay function it describes.
+func (r *DecayRegistry) Build(spec DecaySpec) (G, error) {
+	r.mutex.RLock()
+	factory, found := r.factories[spec.Name]
+	r.mutex.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("%w: %q", UnknownDecayFunctionErr, spec.Name)
+	}
+
+	g, err := factory(spec.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+
+	// breakers divide their counts by g when moving the landmark, including by g(0) when it does not move.
+	if weight := g(0); !(weight > 0) || math.IsInf(weight, 0) {
+		return nil, fmt.Errorf("%s: %w: weight at the landmark must be positive, got %v", spec.Name, InvalidDecaySpecErr, weight)
+	}
+
+	return g, nil
+}
+
+// NewDecay validates the spec and creates a forward decay with the given landmark that reports the spec.
+func (r *DecayRegistry) NewDecay(now time.Time, spec DecaySpec) (ForwardDecay, error) {
+	g, err := r.Build(spec)
+	if err != nil {
+		return ForwardDecay{}, err
+	}
+
+	decay := NewDecay(now, g)
+	decay.spec = spec.clone()
+
+	return decay, nil
+}
+
+// RegisterDecayFunction adds a decay function to the default registry.
+func RegisterDecayFunction(name string, factory DecayFactory) error {
+	return DefaultDecayRegistry.Register(name, factory)
+}
+
+// NewDecayFromSpec creates a forward decay from a spec using the default registry.
+func NewDecayFromSpec(now time.Time, spec DecaySpec) (ForwardDecay, error) {
+	return DefaultDecayRegistry.NewDecay(now, spec)
+}
+
+// ExponentialDecaySpec describes ExponentialDecayFunction.
+func ExponentialDecaySpec(target float64, interval time.Duration) DecaySpec {
+	return DecaySpec{Name: ExponentialDecay, Params: map[string]float64{"target": target, "interval": interval.Seconds()}}
+}
+
+// SlidingExponentialDecaySpec describes SlidingExponentialDecayFunction.
+func SlidingExponentialDecaySpec(window time.Duration) DecaySpec {
+	return DecaySpec{Name: SlidingExponentialDecay, Params: map[string]float64{"window": window.Seconds()}}
+}
+
+// LinearDecaySpec describes LinearDecayFunction.
+func LinearDecaySpec(m float64, b float64) DecaySpec {
+	return DecaySpec{Name: LinearDecay, Params: map[string]float64{"m": m, "b": b}}
+}
+
+// ShiftedPolynomialDecaySpec describes ShiftedPolynomialDecayFunction.
+// PolynomialDecayFunction has no spec, because it gives items at the landmark no weight.
+func ShiftedPolynomialDecaySpec(beta float64) DecaySpec {
+	return DecaySpec{Name: ShiftedPolynomialDecay, Params: map[string]float64{"beta": beta}}
+}
+
+// StepDecaySpec describes StepDecayFunction.
+func StepDecaySpec(factor float64, interval time.Duration) DecaySpec {
+	return DecaySpec{Name: StepDecay, Params: map[string]float64{"factor": factor, "interval": interval.Seconds()}}
+}
+
+// NoDecaySpec describes NoDecayFunction.
+func NoDecaySpec() DecaySpec {
+	return DecaySpec{Name: NoDecay}
+}
+
+// Equal returns true if both specs have the same name and parameters.
+func (s DecaySpec) Equal(other DecaySpec) bool {
+	return s.Name == other.Name && maps.Equal(s.Params, other.Params)
+}
+
+// String formats the spec as name(key=value, ...) with the parameters sorted by key.
+func (s DecaySpec) String() string {
+	params := make([]string, 0, len(s.Params))
+	for _, key := range sortedKeys(s.Params) {
+		params = append(params, fmt.Sprintf("%s=%g", key, s.Params[key]))
+	}
+
+	return fmt.Sprintf("%s(%s)", s.Name, strings.Join(params, ", "))
+}
+
+// clone returns a copy of the spec that does not share its parameters.
+func (s DecaySpec) clone() DecaySpec {
+	return DecaySpec{Name: s.Name, Params: maps.Clone(s.Params)}
+}
+
+// sortedKeys returns the keys of the map in increasing order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// param returns the named parameter, or an error if it is missing or not a finite number.
+func param(params map[string]float64, name string) (float64, error) {
+	value, found := params[name]
+	if !found {
+		return 0, fmt.Errorf("%w: missing parameter %q", InvalidDecaySpecErr, name)
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%w: parameter %q must be finite, got %v", InvalidDecaySpecErr, name, value)
+	}
+
+	return value, nil
+}
+
+// seconds returns the named parameter as a positive duration.
+func seconds(params map[string]float64, name string) (time.Duration, error) {
+	value, err := param(params, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if value <= 0 {
+		return 0, fmt.Errorf("%w: %s must be positive, got %v", InvalidDecaySpecErr, name, value)
+	}
+
+	return time.Duration(value * float64(time.Second)), nil
+}
+
+// fraction returns the named parameter, which must be strictly between 0 and 1.
+func fraction(params map[string]float64, name string) (float64, error) {
+	value, err := param(params, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if value <= 0 || value >= 1 {
+		return 0, fmt.Errorf("%w: %s must be between 0 and 1 exclusive, got %v", InvalidDecaySpecErr, name, value)
+	}
+
+	return value, nil
+}
+
+func exponentialDecayFactory(params map[string]float64) (G, error) {
+	target, err := fraction(params, "target")
+	if err != nil {
+		return nil, err
+	}
+
+	interval, err := seconds(params, "interval")
+	if err != nil {
+		return nil, err
+	}
+
+	return ExponentialDecayFunction(target, interval), nil
+}
+
+func slidingExponentialDecayFactory(params map[string]float64) (G, error) {
+	window, err := seconds(params, "window")
+	if err != nil {
+		return nil, err
+	}
+
+	return SlidingExponentialDecayFunction(window), nil
+}
+
+func linearDecayFactory(params map[string]float64) (G, error) {
+	m, err := param(params, "m")
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := param(params, "b")
+	if err != nil {
+		return nil, err
+	}
+
+	if m < 0 {
+		return nil, fmt.Errorf("%w: m must not be negative, got %v", InvalidDecaySpecErr, m)
+	}
+
+	if b <= 0 {
+		return nil, fmt.Errorf("%w: b must be positive, got %v", InvalidDecaySpecErr, b)
+	}
+
+	return LinearDecayFunction(m, b), nil
+}
+
+func shiftedPolynomialDecayFactory(params map[string]float64) (G, error) {
+	beta, err := param(params, "beta")
+	if err != nil {
+		return nil, err
+	}
+
+	if beta <= 0 {
+		return nil, fmt.Errorf("%w: beta must be positive, got %v", InvalidDecaySpecErr, beta)
+	}
+
+	return ShiftedPolynomialDecayFunction(beta), nil
+}
+
+func stepDecayFactory(params map[string]float64) (G, error) {
+	factor, err := fraction(params, "factor")
+	if err != nil {
+		return nil, err
+	}
+
+	interval, err := seconds(params, "interval")
+	if err != nil {
+		return nil, err
+	}
+
+	return StepDecayFunction(factor, interval), nil
+}
+
+func noDecayFactory(params map[string]float64) (G, error) {
+	if len(params) > 0 {
+		return nil, fmt.Errorf("%w: takes no parameters", InvalidDecaySpecErr)
+	}
+
+	return NoDecayFunction(), nil
+}
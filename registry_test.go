@@ -0,0 +1,137 @@
+package gedcb
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewDecayFromSpec(t *testing.T) {
+	landmark := time.Now()
+	specs := []DecaySpec{
+		ExponentialDecaySpec(0.1, time.Minute),
+		SlidingExponentialDecaySpec(time.Minute),
+		LinearDecaySpec(1, 1),
+		ShiftedPolynomialDecaySpec(2),
+		StepDecaySpec(0.5, time.Minute),
+		NoDecaySpec(),
+	}
+
+	for _, spec := range specs {
+		t.Run(spec.Name, func(t *testing.T) {
+			encoded, err := json.Marshal(spec)
+			require.NoError(t, err)
+
+			var decoded DecaySpec
+			require.NoError(t, json.Unmarshal(encoded, &decoded))
+			require.True(t, spec.Equal(decoded), "%s != %s", spec, decoded)
+
+			decay, err := NewDecayFromSpec(landmark, decoded)
+			require.NoError(t, err)
+			require.True(t, spec.Equal(decay.Spec()))
+
+			older := NewBasicItem(landmark.Add(time.Minute), 1.0)
+			newer := NewBasicItem(landmark.Add(2*time.Minute), 1.0)
+			now := landmark.Add(3 * time.Minute)
+			require.True(t, decay.Weight(older, now) <= decay.Weight(newer, now))
+			require.True(t, decay.Weight(newer, now) <= 1.0)
+		})
+	}
+}
+
+func TestExponentialDecayFunction(t *testing.T) {
+	landmark := time.Now()
+	decay := NewDecay(landmark, ExponentialDecayFunction(0.1, time.Minute))
+	item := NewBasicItem(landmark.Add(time.Minute), 1.0)
+
+	require.InDelta(t, 0.1, decay.Weight(item, landmark.Add(2*time.Minute)), 1e-9)
+	require.Equal(t, DecaySpec{}, decay.Spec())
+}
+
+func TestStepDecayFunction(t *testing.T) {
+	landmark := time.Now()
+	decay := NewDecay(landmark, StepDecayFunction(0.5, time.Minute))
+	now := landmark.Add(150 * time.Second)
+
+	require.Equal(t, 1.0, decay.Weight(NewBasicItem(landmark.Add(121*time.Second), 1.0), now))
+	require.Equal(t, 0.5, decay.Weight(NewBasicItem(landmark.Add(61*time.Second), 1.0), now))
+	require.Equal(t, 0.25, decay.Weight(NewBasicItem(landmark.Add(time.Second), 1.0), now))
+}
+
+func TestShiftedPolynomialDecaySpec(t *testing.T) {
+	landmark := time.Now()
+	decay, err := NewDecayFromSpec(landmark, ShiftedPolynomialDecaySpec(2))
+	require.NoError(t, err)
+
+	require.Equal(t, 1.0, decay.G(0))
+	require.Equal(t, ShiftedPolynomialDecayFunction(2)(time.Minute), decay.G(time.Minute))
+	require.Equal(t, 0.25, decay.Weight(NewBasicItem(landmark, 1.0), landmark.Add(time.Second)))
+
+	// a breaker at the landmark does not divide its counts by zero
+	config := BreakerConfig{WindowSize: time.Minute, SuspicionSuccessThreshold: 10, SoftFailureThreshold: 5, HardFailureThreshold: 50, OpenDuration: time.Second}
+	breaker := NewBreaker(config, decay)
+	require.NoError(t, breaker.Failure(landmark))
+	require.Equal(t, Closed, breaker.State(landmark))
+	require.Equal(t, 1, breaker.Failures(landmark))
+}
+
+func TestDecaySpecZeroAtLandmark(t *testing.T) {
+	registry := NewDecayRegistry()
+	require.NoError(t, registry.Register("zero", func(map[string]float64) (G, error) {
+		return PolynomialDecayFunction(1), nil
+	}))
+
+	_, err := registry.NewDecay(time.Now(), DecaySpec{Name: "zero"})
+	require.True(t, errors.Is(err, InvalidDecaySpecErr))
+}
+
+func TestInvalidDecaySpec(t *testing.T) {
+	specs := []DecaySpec{
+		ExponentialDecaySpec(0, time.Minute),
+		ExponentialDecaySpec(1, time.Minute),
+		ExponentialDecaySpec(0.1, 0),
+		SlidingExponentialDecaySpec(-time.Second),
+		LinearDecaySpec(1, 0),
+		LinearDecaySpec(-1, 1),
+		ShiftedPolynomialDecaySpec(0),
+		ShiftedPolynomialDecaySpec(-2),
+		ShiftedPolynomialDecaySpec(math.NaN()),
+		StepDecaySpec(2, time.Minute),
+		{Name: NoDecay, Params: map[string]float64{"beta": 1}},
+		{Name: ShiftedPolynomialDecay},
+	}
+
+	for _, spec := range specs {
+		t.Run(spec.String(), func(t *testing.T) {
+			_, err := NewDecayFromSpec(time.Now(), spec)
+			require.True(t, errors.Is(err, InvalidDecaySpecErr))
+		})
+	}
+
+	_, err := NewDecayFromSpec(time.Now(), DecaySpec{Name: "unknown"})
+	require.True(t, errors.Is(err, UnknownDecayFunctionErr))
+}
+
+func TestDecayRegistry(t *testing.T) {
+	registry := NewDecayRegistry()
+	factory := func(params map[string]float64) (G, error) {
+		return NoDecayFunction(), nil
+	}
+
+	require.NoError(t, registry.Register("custom", factory))
+	require.True(t, errors.Is(registry.Register("custom", factory), DuplicateDecayFunctionErr))
+	require.True(t, errors.Is(registry.Register(ExponentialDecay, factory), DuplicateDecayFunctionErr))
+	require.Contains(t, registry.Names(), "custom")
+	require.NotContains(t, DefaultDecayRegistry.Names(), "custom")
+
+	decay, err := registry.NewDecay(time.Now(), DecaySpec{Name: "custom"})
+	require.NoError(t, err)
+	require.Equal(t, "custom()", decay.Spec().String())
+}
+
+func TestDecaySpecString(t *testing.T) {
+	require.Equal(t, "exponential(interval=60, target=0.1)", ExponentialDecaySpec(0.1, time.Minute).String())
+}
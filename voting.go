@@ -0,0 +1,187 @@
+package gedcb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unzoned names the group of peers without a zone in state change reasons.
+const unzoned = "(none)"
+
+// InvalidVotingPolicyErr is returned when parsing an unknown or malformed voting policy.
+var InvalidVotingPolicyErr = errors.New("invalid voting policy")
+
+// Vote is a peer's opinion about a breaker, tagged with the peer's availability zone if known.
+// Idle peers have not called the breaker's downstream recently, so their votes are not counted.
+// Health is the peer's Lifeguard health score, zero when healthy. The votes of unhealthy peers weigh less, since they may see spurious failures.
+type Vote struct {
+	Zone   string
+	State  State
+	Idle   bool
+	Health int
+}
+
+// Weight returns how much the vote counts towards a majority: one for a healthy peer, less the higher its health score.
+func (v Vote) Weight() float64 {
+	return 1 / float64(1+max(v.Health, 0))
+}
+
+// Suspects returns true if the peer suspects a failure.
+func (v Vote) Suspects() bool {
+	return v.State != Closed
+}
+
+// VotingPolicy decides whether the peers' votes amount to a majority suspecting a failure.
+// Implementations must be safe for concurrent use; they are called with the breaker locked.
+type VotingPolicy interface {
+	// MajoritySuspect returns true if the votes, keyed by peer, amount to a majority suspecting a failure.
+	MajoritySuspect(votes map[string]Vote) bool
+	// String describes the policy in state change reasons.
+	String() string
+}
+
+// SimpleMajority opens when the majority of all peers suspect a failure, regardless of their zones. It is the default policy.
+// Votes are weighted, so with healthy peers it takes more than half of them.
+type SimpleMajority struct{}
+
+func (SimpleMajority) MajoritySuspect(votes map[string]Vote) bool {
+	suspects, total := 0.0, 0.0
+	for _, vote := range votes {
+		total += vote.Weight()
+
+		if vote.Suspects() {
+			suspects += vote.Weight()
+		}
+	}
+
+	return total > 0 && suspects > total/2
+}
+
+func (SimpleMajority) String() string {
+	return "simple majority"
+}
+
+// ZoneQuorum opens when the majority of peers suspect a failure in at least Zones availability zones,
+// so a network partition within a single zone cannot open breakers across the cluster.
+// Peers without a zone are grouped into one unnamed zone.
+type ZoneQuorum struct {
+	Zones int
+}
+
+func (p ZoneQuorum) MajoritySuspect(votes map[string]Vote) bool {
+	if len(votes) == 0 {
+		return false
+	}
+
+	quorum := 0
+	for _, suspect := range zoneMajorities(votes) {
+		if suspect {
+			quorum++
+		}
+	}
+
+	return quorum >= max(p.Zones, 1)
+}
+
+func (p ZoneQuorum) String() string {
+	return fmt.Sprintf("majority in at least %d zones", p.Zones)
+}
+
+// ZoneMajority opens when the majority of zones each have a majority of peers suspecting a failure,
+// so every zone has one vote regardless of how many replicas it runs. Peers without a zone are grouped into one unnamed zone.
+type ZoneMajority struct{}
+
+func (ZoneMajority) MajoritySuspect(votes map[string]Vote) bool {
+	zones := zoneMajorities(votes)
+
+	suspects := 0
+	for _, suspect := range zones {
+		if suspect {
+			suspects++
+		}
+	}
+
+	return suspects >= len(zones)/2+1
+}
+
+func (ZoneMajority) String() string {
+	return "majority of per-zone majorities"
+}
+
+// openQuorum returns true if the peers that are Open hold more than the given fraction of the votes' total weight.
+// Peers in RemoteOpen only follow others, so they do not count.
+func openQuorum(votes map[string]Vote, fraction float64) bool {
+	open, total := 0.0, 0.0
+	for _, vote := range votes {
+		total += vote.Weight()
+
+		if vote.State == Open {
+			open += vote.Weight()
+		}
+	}
+
+	return total > 0 && open > total*fraction
+}
+
+// zoneMajorities returns whether the majority of peers in each zone suspect a failure.
+func zoneMajorities(votes map[string]Vote) map[string]bool {
+	byZone := make(map[string]map[string]Vote)
+	for peer, vote := range votes {
+		if byZone[vote.Zone] == nil {
+			byZone[vote.Zone] = make(map[string]Vote)
+		}
+
+		byZone[vote.Zone][peer] = vote
+	}
+
+	majorities := make(map[string]bool, len(byZone))
+	for zone, zoneVotes := range byZone {
+		majorities[zone] = SimpleMajority{}.MajoritySuspect(zoneVotes)
+	}
+
+	return majorities
+}
+
+// suspectZones returns the sorted zones whose majority of peers suspect a failure, for state change reasons.
+func suspectZones(votes map[string]Vote) []string {
+	var zones []string
+	for zone, suspect := range zoneMajorities(votes) {
+		if !suspect {
+			continue
+		}
+
+		if zone == "" {
+			zone = unzoned
+		}
+
+		zones = append(zones, zone)
+	}
+
+	sort.Strings(zones)
+
+	return zones
+}
+
+// ParseVotingPolicy parses a voting policy: "simple", "zone-majority" or "zone-quorum:K" for a majority in at least K zones.
+func ParseVotingPolicy(text string) (VotingPolicy, error) {
+	name, param, hasParam := strings.Cut(text, ":")
+
+	switch {
+	case name == "simple" && !hasParam:
+		return SimpleMajority{}, nil
+	case name == "zone-majority" && !hasParam:
+		return ZoneMajority{}, nil
+	case name == "zone-quorum" && hasParam:
+		zones, err := strconv.Atoi(param)
+		if err != nil || zones < 1 {
+			return nil, fmt.Errorf("%w: %q needs a positive number of zones", InvalidVotingPolicyErr, text)
+		}
+
+		return ZoneQuorum{Zones: zones}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", InvalidVotingPolicyErr, text)
+	}
+}
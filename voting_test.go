@@ -0,0 +1,103 @@
+package gedcb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVotingPolicies(t *testing.T) {
+	// a zonal blip: every peer in the largest zone suspects a failure, while the other zones are healthy
+	zonal := map[string]Vote{
+		"a1": {Zone: "a", State: Suspicion},
+		"a2": {Zone: "a", State: Suspicion},
+		"a3": {Zone: "a", State: Open},
+		"b1": {Zone: "b", State: Closed},
+		"c1": {Zone: "c", State: Closed},
+	}
+	// a dependency outage seen from two of three zones, while most replicas run in the healthy zone
+	regional := map[string]Vote{
+		"a1": {Zone: "a", State: Suspicion},
+		"b1": {Zone: "b", State: Suspicion},
+		"c1": {Zone: "c", State: Closed},
+		"c2": {Zone: "c", State: Closed},
+		"c3": {Zone: "c", State: Closed},
+	}
+
+	cases := map[string]struct {
+		policy          VotingPolicy
+		zonal, regional bool
+	}{
+		"simple":         {policy: SimpleMajority{}, zonal: true, regional: false},
+		"quorum of 2":    {policy: ZoneQuorum{Zones: 2}, zonal: false, regional: true},
+		"quorum of 3":    {policy: ZoneQuorum{Zones: 3}, zonal: false, regional: false},
+		"zone majority":  {policy: ZoneMajority{}, zonal: false, regional: true},
+		"quorum of zero": {policy: ZoneQuorum{}, zonal: true, regional: true},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.zonal, c.policy.MajoritySuspect(zonal))
+			require.Equal(t, c.regional, c.policy.MajoritySuspect(regional))
+			require.False(t, c.policy.MajoritySuspect(map[string]Vote{}))
+		})
+	}
+}
+
+func TestParseVotingPolicy(t *testing.T) {
+	for text, expected := range map[string]VotingPolicy{
+		"simple":        SimpleMajority{},
+		"zone-majority": ZoneMajority{},
+		"zone-quorum:2": ZoneQuorum{Zones: 2},
+	} {
+		policy, err := ParseVotingPolicy(text)
+		require.NoError(t, err)
+		require.Equal(t, expected, policy)
+	}
+
+	for _, text := range []string{"", "majority", "simple:1", "zone-quorum", "zone-quorum:0", "zone-quorum:x"} {
+		_, err := ParseVotingPolicy(text)
+		require.True(t, errors.Is(err, InvalidVotingPolicyErr), text)
+	}
+}
+
+func TestBreakerZoneVoting(t *testing.T) {
+	landmark := time.Now()
+	var changes []StateChange
+	config := BreakerConfig{
+		WindowSize:                time.Minute,
+		SuspicionSuccessThreshold: 10,
+		SoftFailureThreshold:      5,
+		HardFailureThreshold:      50,
+		OpenDuration:              time.Second,
+		VotingPolicy:              ZoneQuorum{Zones: 2},
+		OnTransition: func(change StateChange) {
+			changes = append(changes, change)
+		},
+	}
+	breaker := NewBreaker(config, NewDecay(landmark, ExponentialDecayFunction(0.1, config.WindowSize)))
+
+	for _, peer := range []string{"a1", "a2", "a3"} {
+		breaker.UpdatePeerZone(peer, "us-east-1a")
+		breaker.UpdatePeer(peer, Suspicion)
+	}
+	breaker.UpdatePeerZone("b1", "us-east-1b")
+
+	for i := 0; i <= config.SoftFailureThreshold; i++ {
+		require.NoError(t, breaker.Failure(landmark))
+	}
+	require.Equal(t, Suspicion, breaker.State(landmark), "a single zone must not open the breaker")
+
+	breaker.UpdatePeer("b1", Suspicion)
+	require.Equal(t, Open, breaker.State(landmark))
+
+	require.Len(t, changes, 2)
+	require.Equal(t, StateChange{From: Closed, To: Suspicion, Reason: "soft failure threshold exceeded", Timestamp: landmark}, changes[0])
+	require.Equal(t, Open, changes[1].To)
+	require.True(t, strings.Contains(changes[1].Reason, "majority in at least 2 zones"), changes[1].Reason)
+	require.True(t, strings.Contains(changes[1].Reason, "us-east-1a, us-east-1b"), changes[1].Reason)
+	require.Equal(t, changes[1], breaker.LastStateChange())
+}